@@ -0,0 +1,27 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+)
+
+// requireAdmin checks the X-Admin-Token header against ADMIN_TOKEN and
+// writes an error response when the request is not authorised. Handlers
+// must return immediately when it reports false.
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+
+	want := os.Getenv("ADMIN_TOKEN")
+	if want == "" {
+		writeError(w, http.StatusServiceUnavailable, "admin token not configured")
+		return false
+	}
+
+	got := r.Header.Get("X-Admin-Token")
+	if got == "" || subtle.ConstantTimeCompare([]byte(got), []byte(want)) != 1 {
+		writeError(w, http.StatusUnauthorized, "invalid or missing admin token")
+		return false
+	}
+
+	return true
+}
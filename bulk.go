@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+// maxBulkSales caps how many sales one /sales/bulk request may carry.
+const maxBulkSales = 1000
+
+// Statuses of the items in a skipInvalid bulk response.
+const (
+	bulkItemCreated = "created"
+	bulkItemInvalid = "invalid"
+	bulkItemFailed  = "failed"
+)
+
+// bulkItemResult reports what happened to one sale of a skipInvalid bulk
+// request: the recorded sale, the fields that failed validation, or why the
+// database refused it.
+type bulkItemResult struct {
+	Index  int               `json:"index"`
+	Status string            `json:"status"`
+	Sale   *Sale             `json:"sale,omitempty"`
+	Fields map[string]string `json:"fields,omitempty"`
+	Error  string            `json:"error,omitempty"`
+}
+
+type bulkResult struct {
+	Created int              `json:"created"`
+	Skipped int              `json:"skipped"`
+	Items   []bulkItemResult `json:"items"`
+}
+
+// createSalesBulk inserts an array of sales in a single transaction. Either
+// every sale is recorded or none is, unless skipInvalid=true is set; then
+// the bad sales are skipped, the rest recorded, and the outcome of each is
+// reported.
+func createSalesBulk(w http.ResponseWriter, r *http.Request) {
+
+	var sales []Sale
+	if !decodeJSON(w, r, &sales) {
+		return
+	}
+
+	if len(sales) == 0 {
+		writeError(w, http.StatusBadRequest, "at least one sale is required")
+		return
+	}
+	if len(sales) > maxBulkSales {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("at most %d sales per request", maxBulkSales))
+		return
+	}
+
+	if r.URL.Query().Get("skipInvalid") == "true" {
+		createSalesBulkSkipping(w, r, sales)
+		return
+	}
+
+	invalid := map[string]string{}
+
+	for i := range sales {
+		attributeSale(r, &sales[i])
+		errs, err := prepareSale(r.Context(), &sales[i])
+		if err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		for field, msg := range errs {
+			invalid[itemField(i, field)] = msg
+		}
+	}
+
+	if len(invalid) > 0 {
+		writeFieldErrors(w, invalid)
+		return
+	}
+
+	ctx := r.Context()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	for i := range sales {
+		err := recordSale(ctx, tx, &sales[i])
+		if err == errInsufficientStock {
+			writeError(w, http.StatusConflict, fmt.Sprintf("sale %d: not enough stock for this product", i))
+			return
+		}
+		if err != nil {
+			writeInternalError(w, err)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, sales)
+}
+
+// createSalesBulkSkipping records every valid sale of a bulk request. Each
+// insert runs under its own savepoint, so one the database refuses, such as
+// a sale of a product that has run out, is rolled back alone while the
+// others still commit together.
+func createSalesBulkSkipping(w http.ResponseWriter, r *http.Request, sales []Sale) {
+
+	ctx := r.Context()
+	results := make([]bulkItemResult, len(sales))
+
+	for i := range sales {
+		results[i].Index = i
+		attributeSale(r, &sales[i])
+		errs, err := prepareSale(ctx, &sales[i])
+		if err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		if errs != nil {
+			results[i].Status = bulkItemInvalid
+			results[i].Fields = errs
+		}
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	res, err := recordSkipping(ctx, tx, sales, results)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+// recordSkipping records within tx each sale whose result is not already
+// invalid, under its own savepoint, and fills in the results. A sale the
+// database refuses is marked failed while the rest carry on.
+func recordSkipping(ctx context.Context, tx *sql.Tx, sales []Sale, results []bulkItemResult) (bulkResult, error) {
+
+	res := bulkResult{Items: results}
+
+	for i := range sales {
+		if results[i].Status == bulkItemInvalid {
+			res.Skipped++
+			continue
+		}
+
+		msg, err := withSavepoint(ctx, tx, func() error { return recordSale(ctx, tx, &sales[i]) })
+		if err != nil {
+			return res, err
+		}
+		if msg != "" {
+			results[i].Status = bulkItemFailed
+			results[i].Error = msg
+			res.Skipped++
+			continue
+		}
+
+		results[i].Status = bulkItemCreated
+		results[i].Sale = &sales[i]
+		res.Created++
+	}
+
+	return res, nil
+}
+
+// created returns the sales that were recorded, in request order.
+func (res bulkResult) created() []Sale {
+
+	var sales []Sale
+	for _, item := range res.Items {
+		if item.Sale != nil {
+			sales = append(sales, *item.Sale)
+		}
+	}
+	return sales
+}
+
+// itemField names field of the i-th sale in a request that carries several,
+// the same way for a receipt's items and a bulk array.
+func itemField(i int, field string) string {
+	return fmt.Sprintf("items[%d].%s", i, field)
+}
+
+// withSavepoint runs write, which saves one sale within tx, under a
+// savepoint. When the sale itself is at fault the savepoint is rolled back,
+// leaving tx usable, and the reason is returned as msg; err is reserved for
+// failures that doom the whole transaction.
+func withSavepoint(ctx context.Context, tx *sql.Tx, write func() error) (msg string, err error) {
+
+	if _, err := tx.ExecContext(ctx, `SAVEPOINT bulk_item`); err != nil {
+		return "", err
+	}
+
+	err = write()
+	switch {
+	case err == nil:
+		_, err = tx.ExecContext(ctx, `RELEASE SAVEPOINT bulk_item`)
+		return "", err
+	case err == errInsufficientStock:
+		msg = "not enough stock for this product"
+	case isDataError(err):
+		slog.WarnContext(ctx, "sale rejected by the database", "err", err)
+		msg = "rejected by the database"
+	default:
+		return "", err
+	}
+
+	if _, err := tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT bulk_item`); err != nil {
+		return "", err
+	}
+	return msg, nil
+}
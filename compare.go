@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// periodSales is the count and revenue of one side of a comparison. To is
+// exclusive.
+type periodSales struct {
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	Count   int       `json:"count"`
+	Revenue money     `json:"revenue"`
+}
+
+// salesComparison sets a period against an earlier one. The change
+// percentages are null when the previous period had nothing to compare
+// against.
+type salesComparison struct {
+	Currency             string      `json:"currency"`
+	Current              periodSales `json:"current"`
+	Previous             periodSales `json:"previous"`
+	RevenueChangePercent *float64    `json:"revenueChangePercent"`
+	CountChangePercent   *float64    `json:"countChangePercent"`
+}
+
+// getSalesCompare compares the sales between from and to with those between
+// previousFrom and previousTo. Without an explicit previous range it uses
+// the one just before: the same number of calendar months when the period
+// is whole months, so October is compared with September, and otherwise a
+// period of the same length.
+func getSalesCompare(w http.ResponseWriter, r *http.Request) {
+
+	q := r.URL.Query()
+
+	f := revenueSales()
+	if err := f.addCurrency(q); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if q.Get("from") == "" || q.Get("to") == "" {
+		writeError(w, http.StatusBadRequest, "both from and to are required")
+		return
+	}
+	cur, months, err := parsePeriod(q, "from", "to")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var prev periodSales
+	switch {
+	case q.Get("previousFrom") == "" && q.Get("previousTo") == "":
+		if months > 0 {
+			prev.From = cur.From.AddDate(0, -months, 0)
+		} else {
+			prev.From = cur.From.Add(-cur.To.Sub(cur.From))
+		}
+		prev.To = cur.From
+	case q.Get("previousFrom") == "" || q.Get("previousTo") == "":
+		writeError(w, http.StatusBadRequest, "previousFrom and previousTo must be given together")
+		return
+	default:
+		if prev, _, err = parsePeriod(q, "previousFrom", "previousTo"); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	where := f.where()
+	n := len(f.args)
+	args := append(f.args, cur.From.UTC(), cur.To.UTC(), prev.From.UTC(), prev.To.UTC())
+
+	curCond := fmt.Sprintf("created_date >= $%d AND created_date < $%d", n+1, n+2)
+	prevCond := fmt.Sprintf("created_date >= $%d AND created_date < $%d", n+3, n+4)
+
+	err = db.QueryRowContext(r.Context(), `
+		SELECT COUNT(*) FILTER (WHERE `+curCond+`),
+		       COALESCE(SUM(price * quantity) FILTER (WHERE `+curCond+`), 0),
+		       COUNT(*) FILTER (WHERE `+prevCond+`),
+		       COALESCE(SUM(price * quantity) FILTER (WHERE `+prevCond+`), 0)
+		FROM sales
+		`+where, args...).Scan(&cur.Count, &cur.Revenue, &prev.Count, &prev.Revenue)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, salesComparison{
+		Currency:             normalizeCurrency(q.Get("currency")),
+		Current:              cur,
+		Previous:             prev,
+		RevenueChangePercent: percentChange(float64(prev.Revenue), float64(cur.Revenue)),
+		CountChangePercent:   percentChange(float64(prev.Count), float64(cur.Count)),
+	})
+}
+
+// parsePeriod reads the range between the fromKey and toKey parameters,
+// with a date-only end covering that whole day. months is the number of
+// calendar months the range spans when it is made of whole months, and
+// zero otherwise.
+func parsePeriod(q url.Values, fromKey, toKey string) (p periodSales, months int, err error) {
+
+	from, fromDate, err := parseDateParam(q.Get(fromKey))
+	if err != nil {
+		return p, 0, fmt.Errorf("%s: %v", fromKey, err)
+	}
+	to, toDate, err := parseDateParam(q.Get(toKey))
+	if err != nil {
+		return p, 0, fmt.Errorf("%s: %v", toKey, err)
+	}
+	if toDate {
+		to = to.AddDate(0, 0, 1)
+	}
+	if !to.After(from) {
+		return p, 0, fmt.Errorf("%s must be after %s", toKey, fromKey)
+	}
+
+	p.From = from.In(shopLocation)
+	p.To = to.In(shopLocation)
+
+	if fromDate && toDate && p.From.Day() == 1 && p.To.Day() == 1 {
+		months = (p.To.Year()-p.From.Year())*12 + int(p.To.Month()-p.From.Month())
+	}
+	return p, months, nil
+}
+
+// percentChange is the change from prev to cur as a percentage rounded to
+// two places, or nil when prev is zero and there is no meaningful ratio.
+func percentChange(prev, cur float64) *float64 {
+
+	if prev == 0 {
+		return nil
+	}
+	pct := math.Round((cur-prev)/prev*10000) / 100
+	return &pct
+}
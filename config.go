@@ -0,0 +1,261 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the settings read from the environment at startup.
+type Config struct {
+	DatabaseURL     string
+	Port            string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	DBConnectTries  int
+	DBConnectDelay  time.Duration
+	StmtTimeout     time.Duration
+	RequestTimeout  time.Duration
+	HeaderTimeout   time.Duration
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	DuplicateWindow time.Duration
+	AllowedOrigins  []string
+	TrustedProxies  []netip.Prefix
+	CORSMaxAge      int
+	CORSCredentials bool
+	RateLimitRPS    float64
+	RateLimitBurst  int
+	MaxBodyBytes    int
+	MaxSalesLimit   int
+	StaticDir       string
+	WebhookURL      string
+	WebhookSecret   string
+	BasicAuthUser   string
+	BasicAuthPass   string
+	ReadOnly        bool
+	DefaultPayment  string
+	Location        *time.Location
+}
+
+// loadConfig reads Config from the environment, applying defaults for
+// anything unset and rejecting malformed values.
+func loadConfig() (Config, error) {
+
+	cfg := Config{
+		DatabaseURL: os.Getenv("DATABASE_URL"),
+		Port:        envString("PORT", "10000"),
+	}
+
+	if cfg.DatabaseURL == "" {
+		return cfg, fmt.Errorf("DATABASE_URL not set")
+	}
+
+	var err error
+
+	if cfg.MaxOpenConns, err = envInt("MAX_OPEN_CONNS", 3); err != nil {
+		return cfg, err
+	}
+	if cfg.MaxIdleConns, err = envInt("MAX_IDLE_CONNS", 3); err != nil {
+		return cfg, err
+	}
+	if cfg.ConnMaxLifetime, err = envDuration("CONN_MAX_LIFETIME", 30*time.Minute); err != nil {
+		return cfg, err
+	}
+	if cfg.DBConnectTries, err = envInt("DB_CONNECT_ATTEMPTS", 10); err != nil {
+		return cfg, err
+	}
+	if cfg.DBConnectDelay, err = envDuration("DB_CONNECT_BASE_DELAY", 500*time.Millisecond); err != nil {
+		return cfg, err
+	}
+	if cfg.StmtTimeout, err = envDuration("DB_STATEMENT_TIMEOUT", 30*time.Second); err != nil {
+		return cfg, err
+	}
+	if cfg.RequestTimeout, err = envDuration("REQUEST_TIMEOUT", 5*time.Second); err != nil {
+		return cfg, err
+	}
+
+	if cfg.HeaderTimeout, err = envDuration("READ_HEADER_TIMEOUT", 5*time.Second); err != nil {
+		return cfg, err
+	}
+	if cfg.ReadTimeout, err = envDuration("READ_TIMEOUT", 15*time.Second); err != nil {
+		return cfg, err
+	}
+	if cfg.WriteTimeout, err = envDuration("WRITE_TIMEOUT", 30*time.Second); err != nil {
+		return cfg, err
+	}
+	if cfg.IdleTimeout, err = envDuration("IDLE_TIMEOUT", 2*time.Minute); err != nil {
+		return cfg, err
+	}
+	// The write deadline runs from the end of the request headers, so one
+	// shorter than the handler budget would cut off slow but valid replies.
+	if cfg.WriteTimeout <= cfg.RequestTimeout {
+		return cfg, fmt.Errorf("WRITE_TIMEOUT (%v) must be longer than REQUEST_TIMEOUT (%v)", cfg.WriteTimeout, cfg.RequestTimeout)
+	}
+
+	if cfg.DuplicateWindow, err = envDuration("DUPLICATE_WINDOW", time.Minute); err != nil {
+		return cfg, err
+	}
+
+	if cfg.RateLimitRPS, err = envFloat("RATE_LIMIT_RPS", 5); err != nil {
+		return cfg, err
+	}
+	if cfg.RateLimitBurst, err = envInt("RATE_LIMIT_BURST", 10); err != nil {
+		return cfg, err
+	}
+
+	if cfg.MaxBodyBytes, err = envInt("MAX_BODY_BYTES", 1<<20); err != nil {
+		return cfg, err
+	}
+
+	if cfg.MaxSalesLimit, err = envInt("MAX_SALES_LIMIT", 500); err != nil {
+		return cfg, err
+	}
+
+	cfg.DefaultPayment = strings.ToUpper(strings.TrimSpace(envString("DEFAULT_PAYMENT_METHOD", "CASH")))
+	if !paymentMethods[cfg.DefaultPayment] {
+		return cfg, fmt.Errorf("invalid DEFAULT_PAYMENT_METHOD %q: must be one of CASH, CARD, UPI", os.Getenv("DEFAULT_PAYMENT_METHOD"))
+	}
+
+	// APP_TIMEZONE wins over TZ, which also sets the process's local time.
+	zone := envString("APP_TIMEZONE", envString("TZ", "Asia/Kolkata"))
+	if cfg.Location, err = time.LoadLocation(zone); err != nil {
+		return cfg, fmt.Errorf("invalid APP_TIMEZONE %q: %v", zone, err)
+	}
+
+	if cfg.ReadOnly, err = envBool("READ_ONLY", false); err != nil {
+		return cfg, err
+	}
+
+	cfg.AllowedOrigins = envList("ALLOWED_ORIGINS")
+
+	// Each entry is an address or a CIDR range such as 10.0.0.0/8.
+	for _, v := range envList("TRUSTED_PROXIES") {
+		p, err := netip.ParsePrefix(v)
+		if err != nil {
+			addr, aerr := netip.ParseAddr(v)
+			if aerr != nil {
+				return cfg, fmt.Errorf("invalid TRUSTED_PROXIES entry %q: must be an IP address or CIDR range", v)
+			}
+			p = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+		}
+		cfg.TrustedProxies = append(cfg.TrustedProxies, p.Masked())
+	}
+
+	if cfg.CORSMaxAge, err = envInt("CORS_MAX_AGE", 600); err != nil {
+		return cfg, err
+	}
+	if cfg.CORSCredentials, err = envBool("CORS_ALLOW_CREDENTIALS", false); err != nil {
+		return cfg, err
+	}
+	// Browsers refuse credentials with a wildcard origin, and echoing any
+	// origin back instead would let every site act as the user.
+	if cfg.CORSCredentials && (len(cfg.AllowedOrigins) == 0 || slices.Contains(cfg.AllowedOrigins, "*")) {
+		return cfg, fmt.Errorf("CORS_ALLOW_CREDENTIALS needs ALLOWED_ORIGINS to list specific origins")
+	}
+
+	cfg.WebhookURL = os.Getenv("WEBHOOK_URL")
+	cfg.WebhookSecret = os.Getenv("WEBHOOK_SECRET")
+	if cfg.WebhookURL != "" && cfg.WebhookSecret == "" {
+		return cfg, fmt.Errorf("WEBHOOK_SECRET must be set when WEBHOOK_URL is")
+	}
+
+	cfg.BasicAuthUser = os.Getenv("BASIC_AUTH_USER")
+	cfg.BasicAuthPass = os.Getenv("BASIC_AUTH_PASS")
+	if (cfg.BasicAuthUser == "") != (cfg.BasicAuthPass == "") {
+		return cfg, fmt.Errorf("BASIC_AUTH_USER and BASIC_AUTH_PASS must be set together")
+	}
+
+	// An explicitly empty STATIC_DIR turns the file server off.
+	cfg.StaticDir = "./static"
+	if dir, ok := os.LookupEnv("STATIC_DIR"); ok {
+		cfg.StaticDir = strings.TrimSpace(dir)
+	}
+
+	return cfg, nil
+}
+
+func envString(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// envInt reads a positive integer.
+func envInt(key string, def int) (int, error) {
+
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(raw)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid %s %q: must be a positive integer", key, raw)
+	}
+	return n, nil
+}
+
+// envFloat reads a positive number.
+func envFloat(key string, def float64) (float64, error) {
+
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def, nil
+	}
+
+	f, err := strconv.ParseFloat(raw, 64)
+	if err != nil || f <= 0 {
+		return 0, fmt.Errorf("invalid %s %q: must be a positive number", key, raw)
+	}
+	return f, nil
+}
+
+// envDuration reads a positive duration such as "5s" or "30m".
+func envDuration(key string, def time.Duration) (time.Duration, error) {
+
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def, nil
+	}
+
+	d, err := time.ParseDuration(raw)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid %s %q: must be a positive duration", key, raw)
+	}
+	return d, nil
+}
+
+// envBool reads a boolean such as "true", "false", "1" or "0".
+func envBool(key string, def bool) (bool, error) {
+
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def, nil
+	}
+
+	b, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %q: must be true or false", key, raw)
+	}
+	return b, nil
+}
+
+// envList reads a comma-separated list, dropping empty entries.
+func envList(key string) []string {
+
+	var list []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
@@ -0,0 +1,57 @@
+package main
+
+import "net/http"
+
+// allowedOrigins holds the origins from ALLOWED_ORIGINS. When empty, any
+// origin is allowed via the wildcard.
+var allowedOrigins []string
+
+// corsMaxAge is how many seconds browsers may cache a preflight response,
+// from CORS_MAX_AGE.
+var corsMaxAge = "600"
+
+// corsCredentials allows credentialed requests. loadConfig only accepts it
+// alongside specific allowedOrigins, so it is never paired with the wildcard.
+var corsCredentials bool
+
+func enableCORS(w http.ResponseWriter, r *http.Request) {
+
+	h := w.Header()
+
+	if len(allowedOrigins) == 0 {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		for _, o := range allowedOrigins {
+			if o == origin {
+				h.Set("Access-Control-Allow-Origin", origin)
+				if corsCredentials {
+					h.Set("Access-Control-Allow-Credentials", "true")
+				}
+				break
+			}
+		}
+	}
+
+	h.Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+	h.Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-Admin-Token, Idempotency-Key, If-None-Match, If-Match, X-Request-ID, X-User")
+	h.Set("Access-Control-Expose-Headers", "ETag, Location, Link, X-Total-Count, X-Request-ID")
+}
+
+// withCORS adds CORS headers to every response and answers preflight
+// requests without reaching the handler.
+func withCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		enableCORS(w, r)
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Max-Age", corsMaxAge)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
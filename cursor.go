@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// saleCursor is the keyset position of the last sale on a page. Pages are
+// ordered newest first, so the next page holds the sales strictly before
+// (CreatedDate, SaleID).
+//
+// On the wire a cursor is the unpadded base64url encoding of
+// "<created_date as RFC3339Nano in UTC>,<sale_id>". Clients should treat it
+// as opaque and only send back values they were given as nextCursor.
+type saleCursor struct {
+	CreatedDate time.Time
+	SaleID      int
+}
+
+var errMalformedCursor = errors.New("cursor is malformed")
+
+func (c saleCursor) encode() string {
+	raw := c.CreatedDate.UTC().Format(time.RFC3339Nano) + "," + strconv.Itoa(c.SaleID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(s string) (saleCursor, error) {
+
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return saleCursor{}, errMalformedCursor
+	}
+
+	ts, id, ok := strings.Cut(string(raw), ",")
+	if !ok {
+		return saleCursor{}, errMalformedCursor
+	}
+
+	createdDate, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return saleCursor{}, errMalformedCursor
+	}
+
+	saleID, err := strconv.Atoi(id)
+	if err != nil || saleID < 1 {
+		return saleCursor{}, errMalformedCursor
+	}
+
+	return saleCursor{CreatedDate: createdDate, SaleID: saleID}, nil
+}
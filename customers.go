@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type Customer struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Phone     string    `json:"phone"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// phonePattern accepts an optional leading + followed by 7 to 15 digits,
+// allowing spaces or dashes between them.
+var phonePattern = regexp.MustCompile(`^\+?[0-9](?:[ -]?[0-9]){6,14}$`)
+
+func listCustomers(w http.ResponseWriter, r *http.Request) {
+
+	rows, err := db.QueryContext(r.Context(), `
+		SELECT id, name, COALESCE(phone, ''), COALESCE(email, ''), created_at
+		FROM customers
+		ORDER BY name
+	`)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer rows.Close()
+
+	list := []Customer{}
+
+	for rows.Next() {
+		var c Customer
+		if err := rows.Scan(&c.ID, &c.Name, &c.Phone, &c.Email, &c.CreatedAt); err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		c.CreatedAt = c.CreatedAt.In(shopLocation)
+		list = append(list, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+func createCustomer(w http.ResponseWriter, r *http.Request) {
+
+	var c Customer
+	if !decodeJSON(w, r, &c) {
+		return
+	}
+
+	c.Name = strings.TrimSpace(c.Name)
+	c.Phone = strings.TrimSpace(c.Phone)
+	c.Email = strings.TrimSpace(c.Email)
+
+	errs := map[string]string{}
+	if c.Name == "" {
+		errs["name"] = "is required"
+	}
+	if c.Phone != "" && !phonePattern.MatchString(c.Phone) {
+		errs["phone"] = "must be 7 to 15 digits, optionally starting with +"
+	}
+	if c.Email != "" {
+		if addr, err := mail.ParseAddress(c.Email); err != nil || addr.Address != c.Email {
+			errs["email"] = "must be a valid email address"
+		}
+	}
+	if len(errs) > 0 {
+		writeFieldErrors(w, errs)
+		return
+	}
+
+	err := db.QueryRowContext(r.Context(), `
+		INSERT INTO customers (name, phone, email)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''))
+		RETURNING id, created_at
+	`, c.Name, c.Phone, c.Email).Scan(&c.ID, &c.CreatedAt)
+
+	if isUniqueViolation(err) {
+		writeError(w, http.StatusConflict, "a customer with that name already exists")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	c.CreatedAt = c.CreatedAt.In(shopLocation)
+	writeJSON(w, http.StatusCreated, c)
+}
+
+func deleteCustomer(w http.ResponseWriter, r *http.Request) {
+
+	id, ok := pathID(w, r, "customer")
+	if !ok {
+		return
+	}
+
+	res, err := db.ExecContext(r.Context(), "DELETE FROM customers WHERE id=$1", id)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if n == 0 {
+		writeError(w, http.StatusNotFound, "customer not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"message": "Deleted",
+	})
+}
+
+// applyCustomer fills in a sale's customer name from the customer it
+// references. It reports false when the customer does not exist.
+func applyCustomer(ctx context.Context, sale *Sale) (bool, error) {
+
+	var name string
+
+	err := db.QueryRowContext(ctx, `SELECT name FROM customers WHERE id=$1`, *sale.CustomerID).Scan(&name)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if strings.TrimSpace(sale.CustomerName) == "" {
+		sale.CustomerName = name
+	}
+
+	return true, nil
+}
+
+type customerHistory struct {
+	CustomerName string          `json:"customerName"`
+	Sales        []Sale          `json:"sales"`
+	Summary      customerSummary `json:"summary"`
+}
+
+type customerSummary struct {
+	Currency      string `json:"currency"`
+	PurchaseCount int    `json:"purchaseCount"`
+	TotalSpent    money  `json:"totalSpent"`
+}
+
+// getCustomerSales returns every sale recorded under a customer name,
+// matched case-insensitively, with their lifetime spend. A name with no
+// sales yields an empty list rather than 404. Refunded sales are listed
+// but not counted in the summary.
+func getCustomerSales(w http.ResponseWriter, r *http.Request) {
+
+	name := strings.TrimSpace(r.PathValue("name"))
+	if name == "" {
+		writeError(w, http.StatusBadRequest, "customer name is required")
+		return
+	}
+
+	q := r.URL.Query()
+
+	totals := revenueSales()
+	if err := totals.addCurrency(q); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	totals.add("customer_name ILIKE $%d", escapeLike(name))
+
+	f := activeSales()
+	f.add("customer_name ILIKE $%d", escapeLike(name))
+
+	sales, err := querySales(r.Context(), `
+		SELECT `+saleColumns+`
+		FROM sales
+		`+f.where()+`
+		ORDER BY created_date DESC, sale_id DESC
+	`, f.args...)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	summary := customerSummary{Currency: normalizeCurrency(q.Get("currency"))}
+	err = db.QueryRowContext(r.Context(), `
+		SELECT COUNT(*), COALESCE(SUM(price * quantity), 0)
+		FROM sales
+		`+totals.where(), totals.args...).Scan(&summary.PurchaseCount, &summary.TotalSpent)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, customerHistory{
+		CustomerName: name,
+		Sales:        sales,
+		Summary:      summary,
+	})
+}
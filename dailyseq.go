@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// nextDailySeq allocates the next sale number for the local day containing
+// at, mirroring the paper ledger's numbering that restarts every day. The
+// upsert locks that day's counter row until tx ends, so concurrent sales
+// queue for it and can never share a number.
+func nextDailySeq(ctx context.Context, tx *sql.Tx, at time.Time) (int, error) {
+
+	day := at.In(shopLocation).Format("2006-01-02")
+
+	var seq int
+	err := tx.QueryRowContext(ctx, `
+		INSERT INTO daily_sale_counters (day, last_seq) VALUES ($1, 1)
+		ON CONFLICT (day) DO UPDATE SET last_seq = daily_sale_counters.last_seq + 1
+		RETURNING last_seq
+	`, day).Scan(&seq)
+	return seq, err
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// duplicateWindow is how close in time two otherwise identical sales must
+// be for the second to be treated as an accidental re-entry. It is set from
+// DUPLICATE_WINDOW at startup.
+var duplicateWindow = time.Minute
+
+// findDuplicateSale returns a live sale with the same shop, customer,
+// product details, quantity and price recorded within duplicateWindow of
+// sale, or nil if there is none. The description, cell and warranty count
+// too, so two cells of different sizes are not mistaken for a re-entry.
+func findDuplicateSale(ctx context.Context, sale Sale) (*Sale, error) {
+
+	at := sale.CreatedDate
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	// Stored text columns may be NULL where the sale has "".
+	f := activeSales()
+	f.add("COALESCE(shop_name, '') = $%d", sale.ShopName)
+	f.add("customer_name = $%d", sale.CustomerName)
+	f.add("product_name = $%d", sale.ProductName)
+	f.add("COALESCE(description, '') = $%d", sale.Description)
+	f.add("COALESCE(cell_name, '') = $%d", sale.CellName)
+	f.add("COALESCE(warranty, '') = $%d", sale.Warranty)
+	f.add("quantity = $%d", sale.Quantity)
+	f.add("price = $%d", sale.Price)
+	f.add("created_date >= $%d", at.Add(-duplicateWindow).UTC())
+	f.add("created_date <= $%d", at.Add(duplicateWindow).UTC())
+
+	row := db.QueryRowContext(ctx, `
+		SELECT `+saleColumns+`
+		FROM sales
+		`+f.where()+`
+		ORDER BY created_date DESC, sale_id DESC
+		LIMIT 1
+	`, f.args...)
+
+	dup, err := scanSale(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &dup, nil
+}
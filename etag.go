@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// salesETag derives an entity tag for a GET /sales response from the
+// canonical query string and a fingerprint of the matching rows: their
+// count, newest created_date and a sum of per-row hashes, so edits and
+// deletes change it as well as inserts.
+func salesETag(q url.Values, count int, newest time.Time, rowHash int64) string {
+
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%d|%d", q.Encode(), count, newest.UnixNano(), rowHash)))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header lists etag. Weak
+// validators compare equal to their strong form, as RFC 9110 requires for
+// If-None-Match.
+func etagMatches(header, etag string) bool {
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// writeNotModified answers a conditional request whose cached copy is
+// still current.
+func writeNotModified(w http.ResponseWriter, etag string) {
+	w.Header().Set("ETag", etag)
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// saleETag is the entity tag of a single sale, derived from its version so
+// it changes with every update.
+func saleETag(version int) string {
+	return fmt.Sprintf(`"v%d"`, version)
+}
+
+// errVersionRequired is reported when an update names no version to check.
+var errVersionRequired = errors.New("send the sale's version in If-Match or the version field")
+
+// expectedVersion returns the sale version an update was based on, taken
+// from an If-Match header holding the sale's ETag or, failing that, from
+// the body's version field. If-Match: * skips the check and yields 0.
+func expectedVersion(r *http.Request, bodyVersion int) (int, error) {
+
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "*" {
+		return 0, nil
+	}
+
+	if header != "" {
+		raw := strings.TrimSuffix(strings.TrimPrefix(header, `"v`), `"`)
+		v, err := strconv.Atoi(raw)
+		if err != nil || v < 1 || saleETag(v) != header {
+			return 0, fmt.Errorf("If-Match must be a sale ETag such as %s", saleETag(1))
+		}
+		return v, nil
+	}
+
+	if bodyVersion > 0 {
+		return bodyVersion, nil
+	}
+	return 0, errVersionRequired
+}
+
+// writeVersionError answers an update whose expected version is missing
+// or malformed.
+func writeVersionError(w http.ResponseWriter, err error) {
+	if err == errVersionRequired {
+		writeError(w, http.StatusPreconditionRequired, err.Error())
+		return
+	}
+	writeError(w, http.StatusBadRequest, err.Error())
+}
+
+// writeVersionConflict answers an update based on a stale version. The
+// current ETag is included so the client can reload and retry.
+func writeVersionConflict(w http.ResponseWriter, current int) {
+	w.Header().Set("ETag", saleETag(current))
+	writeError(w, http.StatusConflict, fmt.Sprintf("sale was modified by someone else and is now at version %d", current))
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/csv"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var csvHeader = []string{
+	"saleId", "customerName", "productName", "quantity",
+	"price", "currency", "paymentMethod", "createdDate",
+}
+
+// exportSalesCSV streams sales as CSV, writing each row as it is scanned
+// so large exports are never held in memory.
+func exportSalesCSV(w http.ResponseWriter, r *http.Request) {
+
+	f := activeSales()
+	if err := f.addDateRange(r.URL.Query()); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rows, err := db.QueryContext(r.Context(), `
+		SELECT `+saleColumns+`
+		FROM sales
+		`+f.where()+`
+		ORDER BY created_date DESC, sale_id DESC
+	`, f.args...)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer rows.Close()
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="sales.csv"`)
+
+	cw := csv.NewWriter(w)
+	cw.Write(csvHeader)
+
+	for rows.Next() {
+		s, err := scanSale(rows)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "export csv", "err", err)
+			break
+		}
+
+		cw.Write([]string{
+			strconv.Itoa(s.SaleID),
+			s.CustomerName,
+			s.ProductName,
+			strconv.Itoa(s.Quantity),
+			s.Price.String(),
+			s.Currency,
+			s.PaymentMethod,
+			s.CreatedDate.Format(time.RFC3339),
+		})
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.ErrorContext(r.Context(), "export csv", "err", err)
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		slog.ErrorContext(r.Context(), "export csv", "err", err)
+	}
+}
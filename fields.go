@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// saleFields is the set of keys ?fields= may select from a Sale.
+var saleFields = jsonFieldNames(Sale{})
+
+// jsonFieldNames returns the JSON names of v's struct fields.
+func jsonFieldNames(v interface{}) map[string]bool {
+
+	names := map[string]bool{}
+
+	t := reflect.TypeOf(v)
+	for i := 0; i < t.NumField(); i++ {
+		tag, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if tag != "" && tag != "-" {
+			names[tag] = true
+		}
+	}
+	return names
+}
+
+// parseFields splits a comma-separated fields parameter and checks every
+// entry against known. An empty parameter yields nil, meaning all fields.
+func parseFields(raw string, known map[string]bool) ([]string, error) {
+
+	var fields []string
+	for _, f := range strings.Split(raw, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		if !known[f] {
+			valid := make([]string, 0, len(known))
+			for k := range known {
+				valid = append(valid, k)
+			}
+			sort.Strings(valid)
+			return nil, fmt.Errorf("unknown field %q in fields; valid fields are %s", f, strings.Join(valid, ", "))
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// selectFields reduces each sale to the given keys. Keys a sale omits, such
+// as an unset deletedAt, stay omitted.
+func selectFields(sales []Sale, fields []string) ([]map[string]json.RawMessage, error) {
+
+	out := make([]map[string]json.RawMessage, 0, len(sales))
+
+	for _, s := range sales {
+		b, err := json.Marshal(s)
+		if err != nil {
+			return nil, err
+		}
+
+		var all map[string]json.RawMessage
+		if err := json.Unmarshal(b, &all); err != nil {
+			return nil, err
+		}
+
+		picked := make(map[string]json.RawMessage, len(fields))
+		for _, f := range fields {
+			if v, ok := all[f]; ok {
+				picked[f] = v
+			}
+		}
+		out = append(out, picked)
+	}
+
+	return out, nil
+}
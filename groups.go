@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// maxSaleItems caps the line items in one multi-product sale.
+const maxSaleItems = 100
+
+// saleRequest is the createSale body. It is either a single sale, as
+// before, or the details shared by a receipt (customer, payment, currency,
+// date) plus an items array with one entry per product.
+type saleRequest struct {
+	Sale
+	Items []Sale `json:"items"`
+}
+
+// lineItems returns the sales a request records. Items inherit any shared
+// detail they leave empty. The message is non-empty when the request mixes
+// a single product with an items array.
+func (req saleRequest) lineItems() ([]Sale, string) {
+
+	if len(req.Items) == 0 {
+		return []Sale{req.Sale}, ""
+	}
+
+	if req.ProductName != "" || req.ProductID != nil || req.Quantity != 0 || req.Price != 0 {
+		return nil, "give either a single product or items, not both"
+	}
+	if len(req.Items) > maxSaleItems {
+		return nil, fmt.Sprintf("at most %d items per sale", maxSaleItems)
+	}
+
+	items := make([]Sale, len(req.Items))
+	for i, item := range req.Items {
+		if item.ShopName == "" {
+			item.ShopName = req.ShopName
+		}
+		if item.CustomerID == nil {
+			item.CustomerID = req.CustomerID
+		}
+		if item.CustomerName == "" {
+			item.CustomerName = req.CustomerName
+		}
+		if item.PaymentMethod == "" {
+			item.PaymentMethod = req.PaymentMethod
+		}
+		if item.Currency == "" {
+			item.Currency = req.Currency
+		}
+		if item.CreatedDate.IsZero() {
+			item.CreatedDate = req.CreatedDate
+		}
+		if item.CreatedBy == "" {
+			item.CreatedBy = req.CreatedBy
+		}
+		items[i] = item
+	}
+	return items, ""
+}
+
+// saleGroup is one receipt: the line items sharing a sale_group_id.
+type saleGroup struct {
+	SaleGroupID  int       `json:"saleGroupId"`
+	CustomerName string    `json:"customerName"`
+	Currency     string    `json:"currency"`
+	CreatedDate  time.Time `json:"createdDate"`
+	Items        []Sale    `json:"items"`
+	Total        money     `json:"total"`
+}
+
+// newSaleGroup summarises items, which must share a group and be non-empty.
+// Total is the sum of the items' net amounts.
+func newSaleGroup(items []Sale) saleGroup {
+
+	g := saleGroup{
+		SaleGroupID:  items[0].SaleGroupID,
+		CustomerName: items[0].CustomerName,
+		Currency:     items[0].Currency,
+		CreatedDate:  items[0].CreatedDate,
+		Items:        items,
+	}
+	for _, item := range items {
+		g.Total += item.NetAmount
+	}
+	return g
+}
+
+// loadSaleGroup fetches the live items of one group.
+func loadSaleGroup(ctx context.Context, groupID int) (saleGroup, error) {
+
+	f := activeSales()
+	f.add("sale_group_id = $%d", groupID)
+
+	items, err := querySales(ctx, `
+		SELECT `+saleColumns+`
+		FROM sales
+		`+f.where()+`
+		ORDER BY sale_id
+	`, f.args...)
+	if err != nil {
+		return saleGroup{}, err
+	}
+	if len(items) == 0 {
+		return saleGroup{}, fmt.Errorf("sale group %d has no items", groupID)
+	}
+	return newSaleGroup(items), nil
+}
+
+// getSaleGroups lists receipts newest first, each with its line items and
+// total. limit counts receipts, not items.
+func getSaleGroups(w http.ResponseWriter, r *http.Request) {
+
+	q := r.URL.Query()
+
+	limit, err := parseIntParam(q, "limit", min(defaultSalesLimit, maxSalesLimit), 1, maxSalesLimit)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	f := activeSales()
+	if err := f.addDateRange(q); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	where := f.where()
+	limitArg := f.arg(limit)
+
+	// The inner query picks the newest receipts; the join then fetches
+	// all of their items, kept together in that order.
+	items, err := querySales(r.Context(), `
+		SELECT `+saleColumns+`
+		FROM sales
+		JOIN (
+			SELECT sale_group_id, MAX(created_date) AS latest
+			FROM sales
+			`+where+`
+			GROUP BY sale_group_id
+			ORDER BY latest DESC, sale_group_id DESC
+			LIMIT `+limitArg+`
+		) receipts USING (sale_group_id)
+		WHERE deleted_at IS NULL
+		ORDER BY receipts.latest DESC, sale_group_id DESC, sale_id
+	`, f.args...)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	groups := []saleGroup{}
+
+	for start := 0; start < len(items); {
+		end := start + 1
+		for end < len(items) && items[end].SaleGroupID == items[start].SaleGroupID {
+			end++
+		}
+		groups = append(groups, newSaleGroup(items[start:end]))
+		start = end
+	}
+
+	writeJSON(w, http.StatusOK, groups)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxConnectDelay caps the backoff between startup connection attempts.
+const maxConnectDelay = 30 * time.Second
+
+// connectDB pings the database until it answers, making up to attempts
+// tries and doubling the wait after each failure from baseDelay. It lets
+// the service ride out a database that is still starting during a deploy.
+func connectDB(attempts int, baseDelay time.Duration) error {
+
+	delay := baseDelay
+
+	for attempt := 1; ; attempt++ {
+		err := db.Ping()
+		if err == nil {
+			return nil
+		}
+		if attempt >= attempts {
+			return err
+		}
+
+		slog.Warn("database not ready, retrying",
+			"attempt", attempt,
+			"maxAttempts", attempts,
+			"retryIn", delay.String(),
+			"err", err,
+		)
+		time.Sleep(delay)
+
+		delay *= 2
+		if delay > maxConnectDelay {
+			delay = maxConnectDelay
+		}
+	}
+}
+
+// withStatementTimeout adds a statement_timeout to dsn, which lib/pq sends
+// as a run-time parameter on every new connection. The server then aborts
+// any query running longer than d, even one whose request has already
+// given up, so it cannot hold one of the few pooled connections. dsn may be
+// a postgres:// URL or key=value pairs; a statement_timeout it already
+// sets is kept.
+func withStatementTimeout(dsn string, d time.Duration) (string, error) {
+
+	ms := strconv.FormatInt(max(d.Milliseconds(), 1), 10)
+
+	if !strings.HasPrefix(dsn, "postgres://") && !strings.HasPrefix(dsn, "postgresql://") {
+		// In key=value form the last occurrence of a key wins.
+		return "statement_timeout=" + ms + " " + dsn, nil
+	}
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	if q.Get("statement_timeout") == "" {
+		q.Set("statement_timeout", ms)
+		u.RawQuery = q.Encode()
+	}
+	return u.String(), nil
+}
+
+// version identifies the build. Release builds set it with
+// -ldflags "-X main.version=<version>"; otherwise APP_VERSION is used.
+var version = "dev"
+
+// startTime is when the process started, for reporting uptime.
+var startTime = time.Now()
+
+// healthPingTimeout bounds the database ping made by /health.
+const healthPingTimeout = 2 * time.Second
+
+type healthStatus struct {
+	Status        string `json:"status"`
+	Version       string `json:"version"`
+	UptimeSeconds int64  `json:"uptimeSeconds"`
+	DB            string `json:"db"`
+	// TimeZone is the shop's IANA zone, so clients can show and enter
+	// dates the way reports bucket them.
+	TimeZone string `json:"timeZone"`
+}
+
+func health(w http.ResponseWriter, r *http.Request) {
+
+	ctx, cancel := context.WithTimeout(r.Context(), healthPingTimeout)
+	defer cancel()
+
+	status := healthStatus{
+		Status:        "ok",
+		Version:       version,
+		UptimeSeconds: int64(time.Since(startTime).Seconds()),
+		DB:            "up",
+		TimeZone:      shopLocation.String(),
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		slog.ErrorContext(r.Context(), "health: database ping failed", "err", err)
+		status.Status, status.DB = "degraded", "down"
+		writeJSON(w, http.StatusServiceUnavailable, status)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, status)
+}
+
+type dbStats struct {
+	MaxOpenConnections int    `json:"maxOpenConnections"`
+	OpenConnections    int    `json:"openConnections"`
+	InUse              int    `json:"inUse"`
+	Idle               int    `json:"idle"`
+	WaitCount          int64  `json:"waitCount"`
+	WaitDuration       string `json:"waitDuration"`
+	WaitDurationMs     int64  `json:"waitDurationMs"`
+}
+
+func newDBStats(s sql.DBStats) dbStats {
+	return dbStats{
+		MaxOpenConnections: s.MaxOpenConnections,
+		OpenConnections:    s.OpenConnections,
+		InUse:              s.InUse,
+		Idle:               s.Idle,
+		WaitCount:          s.WaitCount,
+		WaitDuration:       s.WaitDuration.String(),
+		WaitDurationMs:     s.WaitDuration.Milliseconds(),
+	}
+}
+
+// getDBStats reports connection-pool statistics. It reads counters kept by
+// database/sql and never touches the database itself.
+func getDBStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, newDBStats(db.Stats()))
+}
+
+// dbMaxIdleConns is the configured idle-pool size, restored after
+// reconnectDB empties the pool. It is set from MAX_IDLE_CONNS at startup.
+var dbMaxIdleConns int
+
+type dbReconnect struct {
+	Reconnected bool    `json:"reconnected"`
+	Stats       dbStats `json:"stats"`
+}
+
+// reconnectDB recovers from a database that has cycled underneath the
+// pool. When a ping fails, every idle connection is closed so the next
+// queries dial afresh with the same settings, and the database is pinged
+// again. The *sql.DB itself is kept: handlers read the global without
+// locking, and it already redials on demand once its idle pool is gone.
+// Connections in use are left alone, and a changed DSN needs a restart.
+func reconnectDB(w http.ResponseWriter, r *http.Request) {
+
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), healthPingTimeout)
+	defer cancel()
+
+	if err := db.PingContext(ctx); err == nil {
+		writeJSON(w, http.StatusOK, dbReconnect{Stats: newDBStats(db.Stats())})
+		return
+	}
+
+	slog.WarnContext(r.Context(), "reconnecting to database")
+
+	db.SetMaxIdleConns(0)
+	db.SetMaxIdleConns(dbMaxIdleConns)
+
+	ctx, cancel = context.WithTimeout(r.Context(), healthPingTimeout)
+	defer cancel()
+
+	if err := db.PingContext(ctx); err != nil {
+		slog.ErrorContext(r.Context(), "database reconnect failed", "err", err)
+		writeError(w, http.StatusServiceUnavailable, "database unavailable")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, dbReconnect{Reconnected: true, Stats: newDBStats(db.Stats())})
+}
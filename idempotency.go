@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// idempotencyWindow is how long an Idempotency-Key is remembered. A key
+// replayed within the window returns the original sale; after it the key
+// may be reused.
+const idempotencyWindow = 24 * time.Hour
+
+// maxIdempotencyKeyLength bounds the Idempotency-Key header.
+const maxIdempotencyKeyLength = 255
+
+// findIdempotentSale returns the sale previously created with key, or nil
+// when the key is new or has expired.
+func findIdempotentSale(ctx context.Context, key string) (*Sale, error) {
+
+	_, err := db.ExecContext(ctx, `
+		DELETE FROM idempotency_keys WHERE created_at < $1
+	`, time.Now().Add(-idempotencyWindow))
+	if err != nil {
+		return nil, err
+	}
+
+	row := db.QueryRowContext(ctx, `
+		SELECT `+saleColumns+`
+		FROM idempotency_keys k
+		JOIN sales ON sales.sale_id = k.sale_id
+		WHERE k.key = $1
+	`, key)
+
+	sale, err := scanSale(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &sale, nil
+}
+
+// saveIdempotencyKey records that key created saleID. A concurrent request
+// with the same key makes this fail with a unique violation.
+func saveIdempotencyKey(ctx context.Context, tx *sql.Tx, key string, saleID int) error {
+
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO idempotency_keys (key, sale_id) VALUES ($1, $2)
+	`, key, saleID)
+	return err
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Limits for /sales/import. They are well above maxBodyBytes and
+// maxBulkSales because an import carries years of history.
+const (
+	maxImportBytes = 32 << 20
+	maxImportRows  = 50000
+)
+
+// importColumns maps the CSV header names /sales/import understands to the
+// sale field each fills. The names match the JSON fields and the export
+// header, so an exported file imports as it is; saleId is ignored.
+var importColumns = map[string]func(s *Sale, v string) string{
+	"saleId":        func(s *Sale, v string) string { return "" },
+	"shopName":      func(s *Sale, v string) string { s.ShopName = v; return "" },
+	"customerName":  func(s *Sale, v string) string { s.CustomerName = v; return "" },
+	"productName":   func(s *Sale, v string) string { s.ProductName = v; return "" },
+	"description":   func(s *Sale, v string) string { s.Description = v; return "" },
+	"cellName":      func(s *Sale, v string) string { s.CellName = v; return "" },
+	"warranty":      func(s *Sale, v string) string { s.Warranty = v; return "" },
+	"paymentMethod": func(s *Sale, v string) string { s.PaymentMethod = v; return "" },
+	"currency":      func(s *Sale, v string) string { s.Currency = v; return "" },
+	"createdBy":     func(s *Sale, v string) string { s.CreatedBy = v; return "" },
+	"quantity": func(s *Sale, v string) string {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return "must be an integer"
+		}
+		s.Quantity = n
+		return ""
+	},
+	"price":    amountColumn(func(s *Sale) *money { return &s.Price }),
+	"discount": amountColumn(func(s *Sale) *money { return &s.Discount }),
+	"taxRate": func(s *Sale, v string) string {
+		if v == "" {
+			return ""
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+			return "must be a number"
+		}
+		s.TaxRate = f
+		return ""
+	},
+	"createdDate": func(s *Sale, v string) string {
+		if v == "" {
+			return ""
+		}
+		t, _, err := parseDateParam(v)
+		if err != nil {
+			return "must be an RFC 3339 timestamp or YYYY-MM-DD date"
+		}
+		s.CreatedDate = t
+		return ""
+	},
+}
+
+// requiredImportColumns must appear in every import header.
+var requiredImportColumns = []string{"customerName", "productName", "quantity", "price"}
+
+func amountColumn(field func(s *Sale) *money) func(s *Sale, v string) string {
+	return func(s *Sale, v string) string {
+		if v == "" {
+			return ""
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+			return "must be a number"
+		}
+		*field(s) = money(f)
+		return ""
+	}
+}
+
+// importFileError is a problem with an import as a whole, such as a bad
+// header, as opposed to one of its rows.
+type importFileError string
+
+func (e importFileError) Error() string { return string(e) }
+
+// importFailure is a CSV row that could not be imported.
+type importFailure struct {
+	Line   int               `json:"line"`
+	Fields map[string]string `json:"fields"`
+}
+
+type importResult struct {
+	Inserted int             `json:"inserted"`
+	Failed   int             `json:"failed"`
+	Failures []importFailure `json:"failures"`
+}
+
+// importSalesCSV records the sales in a CSV upload, sent either as the
+// raw text/csv body or as the "file" part of a multipart form. Rows that
+// fail to parse or validate are reported by line number and skipped; the
+// rest are inserted in one transaction. With strict=true any failure
+// rejects the whole file instead.
+//
+// Imported sales are history, so they fire no webhooks.
+func importSalesCSV(w http.ResponseWriter, r *http.Request) {
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	src, ok := importSource(w, r)
+	if !ok {
+		return
+	}
+
+	strict := r.URL.Query().Get("strict") == "true"
+
+	sales, lines, failures, err := parseImport(r, src)
+	var tooLarge *http.MaxBytesError
+	var fileErr importFileError
+	switch {
+	case errors.As(err, &tooLarge):
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("import exceeds %d bytes", tooLarge.Limit))
+		return
+	case errors.As(err, &fileErr):
+		writeError(w, http.StatusBadRequest, fileErr.Error())
+		return
+	case err != nil:
+		writeInternalError(w, err)
+		return
+	}
+
+	if strict && len(failures) > 0 {
+		fields := map[string]string{}
+		for _, f := range failures {
+			for field, msg := range f.Fields {
+				fields[fmt.Sprintf("line %d.%s", f.Line, field)] = msg
+			}
+		}
+		writeErrorResponse(w, errorResponse{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("%d rows failed; nothing was imported", len(failures)),
+			Fields:  fields,
+		})
+		return
+	}
+
+	ctx := r.Context()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	// A row the database refuses is reported like an invalid one, unless
+	// the import is strict.
+	inserted := 0
+	for i := range sales {
+		msg, err := withSavepoint(ctx, tx, func() error { return insertSale(ctx, tx, &sales[i]) })
+		if err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		if msg != "" {
+			if strict {
+				writeErrorResponse(w, errorResponse{
+					Code:    http.StatusBadRequest,
+					Message: "1 row failed; nothing was imported",
+					Fields:  map[string]string{fmt.Sprintf("line %d.row", lines[i]): msg},
+				})
+				return
+			}
+			failures = append(failures, importFailure{Line: lines[i], Fields: map[string]string{"row": msg}})
+			continue
+		}
+		inserted++
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	sort.Slice(failures, func(i, j int) bool { return failures[i].Line < failures[j].Line })
+
+	writeJSON(w, http.StatusOK, importResult{
+		Inserted: inserted,
+		Failed:   len(failures),
+		Failures: failures,
+	})
+}
+
+// importSource returns the CSV stream of an import request, responding
+// with an error when there is none.
+func importSource(w http.ResponseWriter, r *http.Request) (io.Reader, bool) {
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		mediaType = ""
+	}
+
+	switch mediaType {
+	case "text/csv":
+		return r.Body, true
+
+	case "multipart/form-data":
+		mr, err := r.MultipartReader()
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid multipart body: "+err.Error())
+			return nil, false
+		}
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				writeError(w, http.StatusBadRequest, `multipart body has no "file" part`)
+				return nil, false
+			}
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "invalid multipart body: "+err.Error())
+				return nil, false
+			}
+			if part.FormName() == "file" {
+				return part, true
+			}
+		}
+	}
+
+	writeError(w, http.StatusUnsupportedMediaType, "Content-Type must be text/csv or multipart/form-data")
+	return nil, false
+}
+
+// parseImport reads the header and every row of src, returning the sales
+// that are ready to insert with the line each came from, and the rows that
+// are not. An importFileError
+// means the file as a whole is unusable.
+func parseImport(r *http.Request, src io.Reader) ([]Sale, []int, []importFailure, error) {
+
+	cr := csv.NewReader(src)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil, nil, importFileError("CSV is empty")
+	}
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return nil, nil, nil, importFileError("CSV header: " + parseErr.Error())
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	setters := make([]func(s *Sale, v string) string, len(header))
+	seen := map[string]bool{}
+	for i, name := range header {
+		name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+		set, ok := importColumns[name]
+		if !ok {
+			return nil, nil, nil, importFileError(fmt.Sprintf("CSV header: unknown column %q", name))
+		}
+		header[i] = name
+		setters[i] = set
+		seen[name] = true
+	}
+	for _, name := range requiredImportColumns {
+		if !seen[name] {
+			return nil, nil, nil, importFileError(fmt.Sprintf("CSV header: missing column %q", name))
+		}
+	}
+
+	sales := []Sale{}
+	lines := []int{}
+	failures := []importFailure{}
+
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+
+		if errors.As(err, &parseErr) {
+			failures = append(failures, importFailure{Line: parseErr.Line, Fields: map[string]string{"row": parseErr.Err.Error()}})
+			continue
+		}
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		if len(sales)+len(failures) == maxImportRows {
+			return nil, nil, nil, importFileError(fmt.Sprintf("at most %d rows per import", maxImportRows))
+		}
+
+		line, _ := cr.FieldPos(0)
+
+		if len(record) != len(header) {
+			failures = append(failures, importFailure{Line: line, Fields: map[string]string{
+				"row": fmt.Sprintf("has %d fields, header has %d", len(record), len(header)),
+			}})
+			continue
+		}
+
+		var sale Sale
+		errs := map[string]string{}
+		for i, v := range record {
+			if msg := setters[i](&sale, strings.TrimSpace(v)); msg != "" {
+				errs[header[i]] = msg
+			}
+		}
+
+		// Validate even a row with unparseable values, so every problem on
+		// it is reported at once; the parse error wins for its own field.
+		attributeSale(r, &sale)
+		invalid, err := prepareSale(r.Context(), &sale)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		for field, msg := range invalid {
+			if _, ok := errs[field]; !ok {
+				errs[field] = msg
+			}
+		}
+
+		if len(errs) > 0 {
+			failures = append(failures, importFailure{Line: line, Fields: errs})
+			continue
+		}
+		sales = append(sales, sale)
+		lines = append(lines, line)
+	}
+
+	return sales, lines, failures, nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// getSaleInvoice renders a single-page PDF invoice for one sale.
+func getSaleInvoice(w http.ResponseWriter, r *http.Request) {
+
+	id, ok := pathID(w, r, "sale")
+	if !ok {
+		return
+	}
+
+	f := activeSales()
+	f.add("sale_id = $%d", id)
+
+	row := db.QueryRowContext(r.Context(), `SELECT `+saleColumns+` FROM sales `+f.where(), f.args...)
+
+	sale, err := scanSale(row)
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, "sale not found")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	pdf := renderInvoice(sale)
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="invoice-%d.pdf"`, sale.SaleID))
+	w.Header().Set("Content-Length", strconv.Itoa(len(pdf)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(pdf)
+}
+
+// renderInvoice lays out the invoice for sale on an A4 page.
+func renderInvoice(sale Sale) []byte {
+
+	var c pdfContent
+
+	c.text(pdfBold, 20, 50, 780, "INVOICE")
+	c.text(pdfRegular, 11, 50, 760, sale.ShopName)
+
+	c.text(pdfRegular, 11, 400, 780, fmt.Sprintf("Invoice no. %d", sale.SaleID))
+	c.text(pdfRegular, 11, 400, 764, "Date: "+sale.CreatedDate.Format("02 Jan 2006 15:04"))
+
+	c.text(pdfBold, 11, 50, 720, "Bill to")
+	c.text(pdfRegular, 11, 50, 704, sale.CustomerName)
+
+	c.line(50, 680, 545, 680)
+	c.text(pdfBold, 11, 50, 665, "Product")
+	c.text(pdfBold, 11, 300, 665, "Qty")
+	c.text(pdfBold, 11, 360, 665, "Unit price")
+	c.text(pdfBold, 11, 460, 665, "Amount")
+	c.line(50, 657, 545, 657)
+
+	subtotal := sale.Price * money(sale.Quantity)
+
+	c.text(pdfRegular, 11, 50, 640, sale.ProductName)
+	c.text(pdfRegular, 11, 300, 640, strconv.Itoa(sale.Quantity))
+	c.text(pdfRegular, 11, 360, 640, sale.Price.String())
+	c.text(pdfRegular, 11, 460, 640, subtotal.String())
+
+	y := 630.0
+	if sale.Description != "" {
+		c.text(pdfRegular, 9, 50, y, sale.Description)
+		y -= 12
+	}
+	if sale.Warranty != "" {
+		c.text(pdfRegular, 9, 50, y, "Warranty: "+sale.Warranty)
+	}
+
+	c.line(50, 600, 545, 600)
+
+	y = 582
+	c.text(pdfRegular, 11, 360, y, "Subtotal")
+	c.text(pdfRegular, 11, 460, y, subtotal.String())
+	if sale.Discount != 0 {
+		y -= 16
+		c.text(pdfRegular, 11, 360, y, "Discount")
+		c.text(pdfRegular, 11, 460, y, "-"+sale.Discount.String())
+	}
+	if sale.TaxRate != 0 {
+		y -= 16
+		c.text(pdfRegular, 11, 360, y, fmt.Sprintf("Tax (%s%%)", strconv.FormatFloat(sale.TaxRate*100, 'f', -1, 64)))
+		c.text(pdfRegular, 11, 460, y, (sale.NetAmount - (subtotal - sale.Discount)).String())
+	}
+	y -= 20
+	c.text(pdfBold, 12, 360, y, "Total ("+sale.Currency+")")
+	c.text(pdfBold, 12, 460, y, sale.NetAmount.String())
+
+	y -= 30
+	c.text(pdfRegular, 11, 50, y, "Paid by "+sale.PaymentMethod)
+	if sale.RefundedAt != nil {
+		y -= 16
+		c.text(pdfBold, 11, 50, y, "REFUNDED on "+sale.RefundedAt.Format("02 Jan 2006"))
+	}
+
+	c.text(pdfRegular, 9, 50, 60, "Thank you for your purchase.")
+
+	return c.document()
+}
+
+// The two standard PDF fonts the invoice uses. Standard fonts need no
+// embedding, which keeps the document small and dependency-free.
+const (
+	pdfRegular = "F1"
+	pdfBold    = "F2"
+)
+
+// pdfContent accumulates the drawing operators of a single page.
+type pdfContent struct {
+	ops bytes.Buffer
+}
+
+func (c *pdfContent) text(font string, size, x, y float64, s string) {
+	fmt.Fprintf(&c.ops, "BT /%s %g Tf %g %g Td (%s) Tj ET\n", font, size, x, y, pdfString(s))
+}
+
+func (c *pdfContent) line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(&c.ops, "0.5 w %g %g m %g %g l S\n", x1, y1, x2, y2)
+}
+
+// document wraps the page in a complete PDF file with a valid
+// cross-reference table.
+func (c *pdfContent) document() []byte {
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] " +
+			"/Resources << /Font << /F1 4 0 R /F2 5 0 R >> >> /Contents 6 0 R >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", c.ops.Len(), c.ops.String()),
+	}
+
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	return b.Bytes()
+}
+
+// pdfString escapes s for a PDF literal string. The standard fonts only
+// cover Latin-1, so other characters are replaced with '?'.
+func pdfString(s string) string {
+
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteByte(byte(r))
+		case r == '\n' || r == '\r' || r == '\t':
+			b.WriteByte(' ')
+		case r < 0x20 || r > 0xff:
+			b.WriteByte('?')
+		default:
+			b.WriteByte(byte(r))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// setPaginationHeaders adds X-Total-Count and an RFC 8288 Link header for
+// clients that page from headers rather than the response body. next is
+// only linked when more rows exist and prev only when offset > 0; keyset
+// pages link next through their cursor and never have a prev.
+func setPaginationHeaders(w http.ResponseWriter, r *http.Request, page salesPage) {
+
+	h := w.Header()
+	h.Set("X-Total-Count", strconv.Itoa(page.TotalCount))
+
+	var links []string
+	link := func(rel string, set map[string]string) {
+		q := r.URL.Query()
+		for k, v := range set {
+			q.Set(k, v)
+		}
+		u := url.URL{Path: r.URL.Path, RawQuery: q.Encode()}
+		links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, u.String(), rel))
+	}
+
+	limit := strconv.Itoa(page.Limit)
+
+	if page.NextCursor != "" {
+		link("next", map[string]string{"cursor": page.NextCursor, "limit": limit})
+	} else if page.Truncated {
+		link("next", map[string]string{"offset": strconv.Itoa(page.Offset + page.Limit), "limit": limit})
+	}
+
+	if page.Offset > 0 {
+		link("prev", map[string]string{"offset": strconv.Itoa(max(page.Offset-page.Limit, 0)), "limit": limit})
+	}
+
+	if len(links) > 0 {
+		h.Set("Link", strings.Join(links, ", "))
+	}
+}
@@ -1,227 +1,1356 @@
 package main
 
 import (
+	"context"
 	"database/sql"
-	"encoding/json"
-	"log"
+	"fmt"
+	"log/slog"
+	"math"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
+	// Embedded zone data lets APP_TIMEZONE load on images without tzdata.
+	_ "time/tzdata"
+
 	_ "github.com/lib/pq"
 )
 
+// Sale is one recorded sale. The validate tags declare the per-field
+// constraints checked by validateSale; see checkConstraints.
 type Sale struct {
-	SaleID        int       `json:"saleId"`
-	ShopName      string    `json:"shopName"` // ✅ Added
-	CustomerName  string    `json:"customerName"`
-	ProductName   string    `json:"productName"`
-	Description   string    `json:"description"`
-	CellName      string    `json:"cellName"`
-	Warranty      string    `json:"warranty"`
-	Quantity      int       `json:"quantity"`
-	Price         float64   `json:"price"`
-	PaymentMethod string    `json:"paymentMethod"`
-	CreatedDate   time.Time `json:"createdDate"`
+	SaleID        int        `json:"saleId"`
+	DailySeq      int        `json:"dailySeq,omitempty"`
+	SaleGroupID   int        `json:"saleGroupId"`
+	ShopName      string     `json:"shopName"` // ✅ Added
+	CustomerID    *int       `json:"customerId,omitempty"`
+	CustomerName  string     `json:"customerName" validate:"required"`
+	ProductID     *int       `json:"productId,omitempty"`
+	ProductName   string     `json:"productName" validate:"required"`
+	Description   string     `json:"description"`
+	CellName      string     `json:"cellName"`
+	Warranty      string     `json:"warranty"`
+	Quantity      int        `json:"quantity" validate:"gt=0,lte=2147483647"`
+	Price         money      `json:"price" validate:"gte=0,lte=99999999.99"`
+	Discount      money      `json:"discount" validate:"gte=0,lte=99999999.99"`
+	TaxRate       float64    `json:"taxRate" validate:"gte=0,lte=1"`
+	NetAmount     money      `json:"netAmount"`
+	CostPrice     money      `json:"costPrice"`
+	PaymentMethod string     `json:"paymentMethod"`
+	Currency      string     `json:"currency"`
+	CreatedDate   time.Time  `json:"createdDate"`
+	DeletedAt     *time.Time `json:"deletedAt,omitempty"`
+	Status        string     `json:"status"`
+	RefundedAt    *time.Time `json:"refundedAt,omitempty"`
+	RefundReason  string     `json:"refundReason,omitempty"`
+	Demo          bool       `json:"demo,omitempty"`
+	CreatedBy     string     `json:"createdBy"`
+	Version       int        `json:"version"`
+}
+
+// Sale statuses reported in the status field.
+const (
+	saleStatusCompleted = "completed"
+	saleStatusRefunded  = "refunded"
+)
+
+// saleColumns is the column list every Sale query selects, in the order
+// scanSale expects.
+const saleColumns = `sale_id,
+	COALESCE(daily_seq, 0),
+	sale_group_id,
+	COALESCE(shop_name, ''),
+	customer_id,
+	COALESCE(customer_name, ''),
+	product_id,
+	COALESCE(product_name, ''),
+	COALESCE(description, ''),
+	COALESCE(cell_name, ''),
+	COALESCE(warranty, ''),
+	quantity,
+	price,
+	discount,
+	tax_rate,
+	COALESCE(net_amount, 0),
+	cost_price,
+	COALESCE(payment_method, ''),
+	currency,
+	created_date,
+	deleted_at,
+	refunded_at,
+	COALESCE(refund_reason, ''),
+	demo,
+	created_by,
+	version`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSale(row rowScanner) (Sale, error) {
+
+	var s Sale
+	err := row.Scan(
+		&s.SaleID,
+		&s.DailySeq,
+		&s.SaleGroupID,
+		&s.ShopName,
+		&s.CustomerID,
+		&s.CustomerName,
+		&s.ProductID,
+		&s.ProductName,
+		&s.Description,
+		&s.CellName,
+		&s.Warranty,
+		&s.Quantity,
+		&s.Price,
+		&s.Discount,
+		&s.TaxRate,
+		&s.NetAmount,
+		&s.CostPrice,
+		&s.PaymentMethod,
+		&s.Currency,
+		&s.CreatedDate,
+		&s.DeletedAt,
+		&s.RefundedAt,
+		&s.RefundReason,
+		&s.Demo,
+		&s.CreatedBy,
+		&s.Version,
+	)
+
+	// created_date is stored in UTC; responses show the shop's local time.
+	s.CreatedDate = s.CreatedDate.In(shopLocation)
+	if s.DeletedAt != nil {
+		t := s.DeletedAt.In(shopLocation)
+		s.DeletedAt = &t
+	}
+	s.Status = saleStatusCompleted
+	if s.RefundedAt != nil {
+		t := s.RefundedAt.In(shopLocation)
+		s.RefundedAt = &t
+		s.Status = saleStatusRefunded
+	}
+	return s, err
+}
+
+// querySales runs a query selecting saleColumns and scans every row.
+func querySales(ctx context.Context, query string, args ...interface{}) ([]Sale, error) {
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sales := []Sale{}
+
+	for rows.Next() {
+		s, err := scanSale(rows)
+		if err != nil {
+			return nil, err
+		}
+		sales = append(sales, s)
+	}
+
+	return sales, rows.Err()
+}
+
+const (
+	defaultSalesLimit = 500
+
+	defaultRecentSales = 10
+	maxRecentSales     = 100
+
+	defaultTopSales = 1
+	maxTopSales     = 50
+)
+
+// maxSalesLimit is the largest page GET /sales returns, and the page size
+// when none is asked for. It is set from MAX_SALES_LIMIT at startup.
+var maxSalesLimit = defaultSalesLimit
+
+// salesSortOrders maps the accepted values of the sort query parameter to
+// their ORDER BY clauses. Only these clauses ever reach the SQL.
+var salesSortOrders = map[string]string{
+	"":              "created_date DESC, sale_id DESC",
+	"date_desc":     "created_date DESC, sale_id DESC",
+	"date_asc":      "created_date ASC, sale_id ASC",
+	"price_desc":    "price DESC, sale_id DESC",
+	"price_asc":     "price ASC, sale_id ASC",
+	"quantity_desc": "quantity DESC, sale_id DESC",
+}
+
+// salesPage is the GET /sales response. Sales is a []Sale, or the sales
+// reduced to the requested keys when ?fields= is given.
+type salesPage struct {
+	Sales      interface{} `json:"sales"`
+	TotalCount int         `json:"totalCount"`
+	Limit      int         `json:"limit"`
+	Offset     int         `json:"offset"`
+	MaxLimit   int         `json:"maxLimit"`
+	Truncated  bool        `json:"truncated"`
+	NextCursor string      `json:"nextCursor,omitempty"`
 }
 
 var db *sql.DB
 
+// shutdownTimeout is how long in-flight requests get to finish after a
+// termination signal.
+const shutdownTimeout = 10 * time.Second
+
+// shopLocation is the shop's local time zone, used to bucket reports by
+// business day. It is set from APP_TIMEZONE at startup.
+var shopLocation *time.Location
+
+// setShopLocation makes loc the zone for responses and report buckets.
+// The zone name comes from time.LoadLocation, so it is a known IANA name
+// that Postgres understands too.
+func setShopLocation(loc *time.Location) {
+	shopLocation = loc
+	createdDateLocal = "(created_date AT TIME ZONE '" + strings.ReplaceAll(loc.String(), "'", "''") + "')"
+}
+
 func main() {
 
-	dbURL := os.Getenv("DATABASE_URL")
-	if dbURL == "" {
-		log.Fatal("DATABASE_URL not set")
+	// Logging comes first so configuration errors are reported as JSON.
+	if err := setupLogging(os.Getenv("LOG_LEVEL")); err != nil {
+		fatal("configure logging", err)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fatal("load config", err)
+	}
+
+	if v := os.Getenv("APP_VERSION"); v != "" && version == "dev" {
+		version = v
+	}
+
+	setShopLocation(cfg.Location)
+	allowedOrigins = cfg.AllowedOrigins
+	trustedProxies = cfg.TrustedProxies
+	corsMaxAge = strconv.Itoa(cfg.CORSMaxAge)
+	corsCredentials = cfg.CORSCredentials
+	basicAuthUser = cfg.BasicAuthUser
+	basicAuthPass = cfg.BasicAuthPass
+	requestTimeout = cfg.RequestTimeout
+	duplicateWindow = cfg.DuplicateWindow
+	maxSalesLimit = cfg.MaxSalesLimit
+	defaultPaymentMethod = cfg.DefaultPayment
+
+	if cfg.WebhookURL != "" {
+		webhooks = newWebhookNotifier(cfg.WebhookURL, cfg.WebhookSecret)
 	}
+	maxBodyBytes = int64(cfg.MaxBodyBytes)
 
-	var err error
-	db, err = sql.Open("postgres", dbURL)
+	readOnly.Store(cfg.ReadOnly)
+	if cfg.ReadOnly {
+		slog.Warn("starting in read-only mode")
+	}
+
+	dsn, err := withStatementTimeout(cfg.DatabaseURL, cfg.StmtTimeout)
 	if err != nil {
-		log.Fatal(err)
+		fatal("parse DATABASE_URL", err)
 	}
 
-	if err = db.Ping(); err != nil {
-		log.Fatal(err)
+	db, err = sql.Open("postgres", dsn)
+	if err != nil {
+		fatal("open database", err)
 	}
 
-	ensureTables()
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	dbMaxIdleConns = cfg.MaxIdleConns
+	db.SetMaxIdleConns(dbMaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
+	if err = connectDB(cfg.DBConnectTries, cfg.DBConnectDelay); err != nil {
+		fatal("connect to database", err)
+	}
+
+	if err = migrate(); err != nil {
+		fatal("migrate database", err)
+	}
 
 	// 🔥 One-time fix for old records without branch
 	db.Exec("UPDATE sales SET shop_name='KurnoolRoad' WHERE shop_name IS NULL OR shop_name=''")
 
-	http.HandleFunc("/sales", getSales)
-	http.HandleFunc("/sales/create", createSale)
-	http.HandleFunc("/sales/delete", deleteSale)
-	http.HandleFunc("/sales/reset", resetSales)
+	// Write endpoints share one per-client budget.
+	writeLimiter := newRateLimiter(cfg.RateLimitRPS, cfg.RateLimitBurst)
+
+	http.HandleFunc("GET /openapi.json", getOpenAPISpec)
+	http.HandleFunc("GET /health", health)
+	http.HandleFunc("GET /debug/db", getDBStats)
+	http.HandleFunc("GET /metrics", getMetrics)
+	http.HandleFunc("GET /admin/read-only", getReadOnly)
+	http.HandleFunc("PUT /admin/read-only", setReadOnly)
+	http.HandleFunc("POST /admin/db/reconnect", reconnectDB)
+	http.HandleFunc("POST /admin/seed", unlessReadOnly(seedSales))
+	http.HandleFunc("DELETE /admin/seed", unlessReadOnly(deleteDemoSales))
+
+	http.HandleFunc("GET /sales", getSales)
+	http.HandleFunc("DELETE /sales", unlessReadOnly(deleteSalesInRange))
+	http.HandleFunc("PATCH /sales/payment-method", unlessReadOnly(updatePaymentMethods))
+	http.HandleFunc("GET /sales/{id}", getSale)
+	http.HandleFunc("PUT /sales/{id}", unlessReadOnly(updateSale))
+	http.HandleFunc("PATCH /sales/{id}", unlessReadOnly(patchSale))
+	http.HandleFunc("DELETE /sales/{id}", unlessReadOnly(deleteSaleByID))
+	http.HandleFunc("POST /sales/{id}/restore", unlessReadOnly(restoreSale))
+	http.HandleFunc("POST /sales/{id}/refund", unlessReadOnly(refundSale))
+	http.HandleFunc("GET /sales/{id}/invoice", getSaleInvoice)
+	http.HandleFunc("GET /sales/recent", getRecentSales)
+	http.HandleFunc("GET /sales/top", getTopSales)
+	http.HandleFunc("GET /sales/groups", getSaleGroups)
+	http.HandleFunc("GET /sales/search", searchSales)
+	http.HandleFunc("GET /sales/products", getSaleProductNames)
+	http.HandleFunc("GET /sales/customers", getSaleCustomerNames)
+	http.HandleFunc("GET /sales/count", getSalesCount)
+	http.HandleFunc("GET /sales/summary", getSalesSummary)
+	http.HandleFunc("GET /sales/profit", getSalesProfit)
+	http.HandleFunc("GET /sales/compare", getSalesCompare)
+	http.HandleFunc("GET /sales/by-product", getSalesByProduct)
+	http.HandleFunc("GET /sales/avg-by-product", getSalesAvgByProduct)
+	http.HandleFunc("GET /sales/daily", getDailySales)
+	http.HandleFunc("GET /sales/weekly", getWeeklySales)
+	http.HandleFunc("GET /sales/monthly", getMonthlySales)
+	http.HandleFunc("GET /sales/by-hour", getSalesByHour)
+	http.HandleFunc("GET /sales/by-payment", getSalesByPayment)
+	http.HandleFunc("GET /sales/by-staff", getSalesByStaff)
+	http.HandleFunc("GET /sales/top-customers", getTopCustomers)
+	http.HandleFunc("GET /sales/export.csv", exportSalesCSV)
+	http.HandleFunc("GET /sales/stream", streamSales)
+	http.HandleFunc("POST /sales/create", unlessReadOnly(writeLimiter.limit(createSale)))
+	http.HandleFunc("POST /sales/bulk", unlessReadOnly(writeLimiter.limit(createSalesBulk)))
+	http.HandleFunc("POST /sales/import", unlessReadOnly(writeLimiter.limit(importSalesCSV)))
+	http.HandleFunc("GET /sales/delete", unlessReadOnly(writeLimiter.limit(deleteSale)))
+	http.HandleFunc("POST /sales/reset", unlessReadOnly(writeLimiter.limit(resetSales)))
+
+	http.HandleFunc("GET /products", listProducts)
+	http.HandleFunc("POST /products", unlessReadOnly(createProduct))
+	http.HandleFunc("DELETE /products/{id}", unlessReadOnly(deleteProduct))
+	http.HandleFunc("GET /products/{id}/price-history", getProductPriceHistory)
 
-	http.Handle("/", http.FileServer(http.Dir("./static")))
+	http.HandleFunc("GET /customers", listCustomers)
+	http.HandleFunc("POST /customers", unlessReadOnly(createCustomer))
+	http.HandleFunc("DELETE /customers/{id}", unlessReadOnly(deleteCustomer))
+	http.HandleFunc("GET /customers/{name}/sales", getCustomerSales)
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "10000"
+	http.Handle(staticPattern, staticHandler(cfg.StaticDir))
+
+	// The timeouts stop slow or stalled clients from holding connections
+	// open; withTimeout lifts the read and write ones for streamingPaths.
+	server := &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           newHandler(http.DefaultServeMux),
+		ReadHeaderTimeout: cfg.HeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
 	}
 
-	log.Println("Server running on port", port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+	go func() {
+		slog.Info("server running", "port", cfg.Port, "version", version)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fatal("serve", err)
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	sig := <-stop
+
+	slog.Info("shutting down", "signal", sig.String())
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Error("server shutdown", "err", err)
+	} else {
+		slog.Info("server stopped")
+	}
+
+	webhooks.wait(ctx)
+
+	if err := db.Close(); err != nil {
+		slog.Error("close database", "err", err)
+	} else {
+		slog.Info("database connection closed")
+	}
 }
 
-func ensureTables() {
+func getSales(w http.ResponseWriter, r *http.Request) {
 
-	query := `
-	CREATE TABLE IF NOT EXISTS sales (
-		sale_id SERIAL PRIMARY KEY,
-		shop_name TEXT,
-		customer_name TEXT,
-		product_name TEXT,
-		description TEXT,
-		cell_name TEXT,
-		warranty TEXT,
-		quantity INT,
-		price NUMERIC(10,2),
-		payment_method TEXT,
-		created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-	);
-	`
+	q := r.URL.Query()
 
-	_, err := db.Exec(query)
+	limit, err := parseIntParam(q, "limit", maxSalesLimit, 1, maxSalesLimit)
 	if err != nil {
-		log.Fatal(err)
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
-	// 🔥 Auto-fix for existing databases
-	_, err = db.Exec(`ALTER TABLE sales ADD COLUMN IF NOT EXISTS shop_name TEXT;`)
+	offset, err := parseIntParam(q, "offset", 0, 0, math.MaxInt32)
 	if err != nil {
-		log.Fatal(err)
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
-	_, err = db.Exec(`ALTER TABLE sales ADD COLUMN IF NOT EXISTS description TEXT;`)
+	orderBy, ok := salesSortOrders[q.Get("sort")]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "sort must be one of date_asc, date_desc, price_asc, price_desc, quantity_desc")
+		return
+	}
+
+	fields, err := parseFields(q.Get("fields"), saleFields)
 	if err != nil {
-		log.Fatal(err)
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
 	}
-}
 
-func getSales(w http.ResponseWriter, r *http.Request) {
+	// Passing cursor, even empty for the first page, switches to keyset
+	// pagination over the newest-first order.
+	keyset := q.Has("cursor")
+	var after *saleCursor
+
+	if keyset {
+		if q.Get("offset") != "" || (q.Get("sort") != "" && q.Get("sort") != "date_desc") {
+			writeError(w, http.StatusBadRequest, "cursor cannot be combined with offset or sort")
+			return
+		}
+		if raw := q.Get("cursor"); raw != "" {
+			c, err := decodeCursor(raw)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			after = &c
+		}
+	}
+
+	var f sqlFilter
+
+	if q.Get("includeDeleted") != "true" {
+		f = activeSales()
+	}
+
+	if shop := q.Get("shop"); shop != "" {
+		f.add("shop_name = $%d", shop)
+	}
+
+	if customer := q.Get("customer"); customer != "" {
+		f.add("customer_name ILIKE $%d", "%"+escapeLike(customer)+"%")
+	}
+
+	minPrice, err := parseAmountParam(q, "minPrice")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	maxPrice, err := parseAmountParam(q, "maxPrice")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if minPrice != nil && maxPrice != nil && *minPrice > *maxPrice {
+		writeError(w, http.StatusBadRequest, "minPrice must not exceed maxPrice")
+		return
+	}
+	if minPrice != nil {
+		f.add("price >= $%d", *minPrice)
+	}
+	if maxPrice != nil {
+		f.add("price <= $%d", *maxPrice)
+	}
+
+	if err := f.addDateRange(q); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// The count query also fingerprints the matching rows, which is enough
+	// to answer a poller's If-None-Match without fetching the page.
+	var total int
+	var newest time.Time
+	var rowHash int64
+	err = db.QueryRowContext(r.Context(), `
+		SELECT COUNT(*),
+		       COALESCE(MAX(created_date), 'epoch'),
+		       COALESCE(SUM(hashtext(sales::text)), 0)
+		FROM sales
+		`+f.where(), f.args...).Scan(&total, &newest, &rowHash)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
 
-	shop := r.URL.Query().Get("shop")
-
-	var rows *sql.Rows
-	var err error
-
-	if shop != "" {
-		rows, err = db.Query(`
-			SELECT sale_id, shop_name, customer_name, product_name,
-			       COALESCE(description, ''),
-			       cell_name, warranty, quantity,
-			       price, payment_method, created_date
-			FROM sales
-			WHERE shop_name = $1
-			ORDER BY created_date DESC
-		`, shop)
+	etag := salesETag(q, total, newest, rowHash)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		writeNotModified(w, etag)
+		return
+	}
+
+	if after != nil {
+		createdArg, idArg := f.arg(after.CreatedDate), f.arg(after.SaleID)
+		f.cond(fmt.Sprintf("(created_date, sale_id) < (%s, %s)", createdArg, idArg))
+	}
+
+	where := f.where()
+	limitArg, offsetArg := f.arg(limit), f.arg(offset)
+
+	sales, err := querySales(r.Context(), fmt.Sprintf(`
+		SELECT %s
+		FROM sales
+		%s
+		ORDER BY %s
+		LIMIT %s OFFSET %s
+	`, saleColumns, where, orderBy, limitArg, offsetArg), f.args...)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	page := salesPage{
+		Sales:      sales,
+		TotalCount: total,
+		Limit:      limit,
+		Offset:     offset,
+		MaxLimit:   maxSalesLimit,
+	}
+
+	// Truncated tells clients that more rows match than this page holds.
+	if keyset {
+		if len(sales) == limit {
+			last := sales[len(sales)-1]
+			page.NextCursor = saleCursor{CreatedDate: last.CreatedDate, SaleID: last.SaleID}.encode()
+			page.Truncated = true
+		}
 	} else {
-		rows, err = db.Query(`
-			SELECT sale_id, shop_name, customer_name, product_name,
-			       COALESCE(description, ''),
-			       cell_name, warranty, quantity,
-			       price, payment_method, created_date
-			FROM sales
-			ORDER BY created_date DESC
-		`)
+		page.Truncated = offset+len(sales) < total
+	}
+
+	if fields != nil {
+		if page.Sales, err = selectFields(sales, fields); err != nil {
+			writeInternalError(w, err)
+			return
+		}
 	}
 
+	setPaginationHeaders(w, r, page)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	writeJSON(w, http.StatusOK, page)
+}
+
+// getRecentSales returns the n newest sales, for the live ticker.
+func getRecentSales(w http.ResponseWriter, r *http.Request) {
+
+	n, err := parseIntParam(r.URL.Query(), "n", defaultRecentSales, 1, maxRecentSales)
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	defer rows.Close()
 
-	var sales []Sale
+	f := activeSales()
+	where := f.where()
+	limitArg := f.arg(n)
 
-	for rows.Next() {
-		var s Sale
-		rows.Scan(
-			&s.SaleID,
-			&s.ShopName,
-			&s.CustomerName,
-			&s.ProductName,
-			&s.Description,
-			&s.CellName,
-			&s.Warranty,
-			&s.Quantity,
-			&s.Price,
-			&s.PaymentMethod,
-			&s.CreatedDate,
-		)
-		sales = append(sales, s)
+	sales, err := querySales(r.Context(), `
+		SELECT `+saleColumns+`
+		FROM sales
+		`+where+`
+		ORDER BY created_date DESC, sale_id DESC
+		LIMIT `+limitArg, f.args...)
+	if err != nil {
+		writeInternalError(w, err)
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(sales)
+	writeJSON(w, http.StatusOK, sales)
 }
 
-func createSale(w http.ResponseWriter, r *http.Request) {
+// getTopSales returns the limit largest sales by price * quantity, for
+// highlights such as the biggest sale of the month. Refunds are left out,
+// and ties go to the earlier sale.
+func getTopSales(w http.ResponseWriter, r *http.Request) {
+
+	q := r.URL.Query()
+
+	limit, err := parseIntParam(q, "limit", defaultTopSales, 1, maxTopSales)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	f := revenueSales()
+	if err := f.addCurrency(q); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := f.addDateRange(q); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	where := f.where()
+	limitArg := f.arg(limit)
+
+	sales, err := querySales(r.Context(), `
+		SELECT `+saleColumns+`
+		FROM sales
+		`+where+`
+		ORDER BY price * quantity DESC, created_date, sale_id
+		LIMIT `+limitArg, f.args...)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, sales)
+}
+
+func getSale(w http.ResponseWriter, r *http.Request) {
+
+	id, ok := pathID(w, r, "sale")
+	if !ok {
+		return
+	}
+
+	query := `SELECT ` + saleColumns + ` FROM sales WHERE sale_id = $1`
+	if r.URL.Query().Get("includeDeleted") != "true" {
+		query += ` AND deleted_at IS NULL`
+	}
+
+	row := db.QueryRowContext(r.Context(), query, id)
+
+	sale, err := scanSale(row)
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, "sale not found")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", saleETag(sale.Version))
+	writeJSON(w, http.StatusOK, sale)
+}
+
+// updateSale replaces the editable fields of a sale with those in the body:
+// shop, customer and product names, description, cell name, warranty,
+// quantity, price, discount, tax rate, payment method and currency. Fields
+// left out are reset, so the body is validated as the row that will be
+// stored, discount included. Other fields, such as createdDate, are ignored.
+func updateSale(w http.ResponseWriter, r *http.Request) {
+
+	id, ok := pathID(w, r, "sale")
+	if !ok {
+		return
+	}
 
 	var sale Sale
-	json.NewDecoder(r.Body).Decode(&sale)
+	if !decodeJSON(w, r, &sale) {
+		return
+	}
+
+	version, err := expectedVersion(r, sale.Version)
+	if err != nil {
+		writeVersionError(w, err)
+		return
+	}
+
+	sale.PaymentMethod = normalizePaymentMethod(sale.PaymentMethod)
+	sale.Currency = normalizeCurrency(sale.Currency)
+	// The stored date is kept, so a date in the body has nothing to validate.
+	sale.CreatedDate = time.Time{}
+
+	if errs := validateSale(sale); errs != nil {
+		writeFieldErrors(w, errs)
+		return
+	}
+
+	ctx := r.Context()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	current, err := scanSale(tx.QueryRowContext(ctx, `
+		SELECT `+saleColumns+`
+		FROM sales
+		WHERE sale_id = $1 AND deleted_at IS NULL
+		FOR UPDATE
+	`, id))
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, "sale not found")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	// A version of 0 (If-Match: *) matches whatever is stored.
+	if version != 0 && version != current.Version {
+		writeVersionConflict(w, current.Version)
+		return
+	}
+
+	err = changeSoldQuantity(ctx, tx, current, sale.Quantity)
+	if err == errInsufficientStock {
+		writeError(w, http.StatusConflict, "not enough stock for this product")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	updated, err := scanSale(tx.QueryRowContext(ctx, `
+		UPDATE sales SET
+			shop_name = $1,
+			customer_name = $2,
+			product_name = $3,
+			description = $4,
+			cell_name = $5,
+			warranty = $6,
+			quantity = $7,
+			price = $8,
+			discount = $9,
+			tax_rate = $10,
+			payment_method = $11,
+			currency = $12,
+			version = version + 1
+		WHERE sale_id = $13
+		RETURNING `+saleColumns,
+		sale.ShopName,
+		sale.CustomerName,
+		sale.ProductName,
+		sale.Description,
+		sale.CellName,
+		sale.Warranty,
+		sale.Quantity,
+		sale.Price,
+		sale.Discount,
+		sale.TaxRate,
+		sale.PaymentMethod,
+		sale.Currency,
+		id,
+	))
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
 
-	_, err := db.Exec(`
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", saleETag(updated.Version))
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// deleteSaleByID soft-deletes a sale: the row is kept, with deleted_at set,
+// so it can be restored.
+func deleteSaleByID(w http.ResponseWriter, r *http.Request) {
+
+	id, ok := pathID(w, r, "sale")
+	if !ok {
+		return
+	}
+
+	n, err := softDeleteSale(r.Context(), id)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if n == 0 {
+		writeError(w, http.StatusNotFound, "sale not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"message":      "Deleted",
+		"rowsAffected": n,
+	})
+}
+
+func softDeleteSale(ctx context.Context, id interface{}) (int64, error) {
+
+	res, err := db.ExecContext(ctx, `
+		UPDATE sales SET deleted_at = NOW()
+		WHERE sale_id = $1 AND deleted_at IS NULL
+	`, id)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func restoreSale(w http.ResponseWriter, r *http.Request) {
+
+	id, ok := pathID(w, r, "sale")
+	if !ok {
+		return
+	}
+
+	row := db.QueryRowContext(r.Context(), `
+		UPDATE sales SET deleted_at = NULL
+		WHERE sale_id = $1 AND deleted_at IS NOT NULL
+		RETURNING `+saleColumns, id)
+
+	sale, err := scanSale(row)
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, "no deleted sale with that id")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, sale)
+}
+
+// parseIntParam reads an optional integer query parameter, falling back to
+// def when it is absent and rejecting values outside [min, max].
+func parseIntParam(q url.Values, name string, def, min, max int) (int, error) {
+
+	raw := q.Get(name)
+	if raw == "" {
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an integer", name)
+	}
+
+	if n < min || n > max {
+		return 0, fmt.Errorf("%s must be between %d and %d", name, min, max)
+	}
+
+	return n, nil
+}
+
+// parseAmountParam parses an optional non-negative amount. A nil result
+// means the parameter was not given.
+func parseAmountParam(q url.Values, name string) (*money, error) {
+
+	raw := q.Get(name)
+	if raw == "" {
+		return nil, nil
+	}
+
+	f, err := strconv.ParseFloat(raw, 64)
+	if err != nil || f < 0 || math.IsInf(f, 0) || math.IsNaN(f) {
+		return nil, fmt.Errorf("%s must be a non-negative number", name)
+	}
+
+	m := money(f)
+	return &m, nil
+}
+
+// pathID parses the {id} path value as a positive integer, responding 400
+// on failure. what names the resource in the error message.
+func pathID(w http.ResponseWriter, r *http.Request, what string) (int, bool) {
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		writeError(w, http.StatusBadRequest, "invalid "+what+" id")
+		return 0, false
+	}
+	return id, true
+}
+
+func createSale(w http.ResponseWriter, r *http.Request) {
+
+	if !requireJSONContentType(w, r) {
+		return
+	}
+
+	var req saleRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	grouped := len(req.Items) > 0
+
+	items, msg := req.lineItems()
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	ctx := r.Context()
+
+	key := r.Header.Get("Idempotency-Key")
+	if len(key) > maxIdempotencyKeyLength {
+		writeError(w, http.StatusBadRequest, "Idempotency-Key is too long")
+		return
+	}
+
+	if key != "" {
+		original, err := findIdempotentSale(ctx, key)
+		if err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		if original != nil {
+			writeReplayedSale(w, r, *original, grouped)
+			return
+		}
+	}
+
+	// With skipInvalid=true a receipt keeps its good items: bad ones are
+	// reported in results instead of rejecting the request.
+	skip := grouped && r.URL.Query().Get("skipInvalid") == "true"
+	var results []bulkItemResult
+	if skip {
+		results = make([]bulkItemResult, len(items))
+	}
+
+	invalid := map[string]string{}
+
+	for i := range items {
+		attributeSale(r, &items[i])
+		errs, err := prepareSale(ctx, &items[i])
+		if err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		if skip {
+			results[i].Index = i
+			if errs != nil {
+				results[i].Status = bulkItemInvalid
+				results[i].Fields = errs
+			}
+			continue
+		}
+		for field, msg := range errs {
+			if grouped {
+				field = itemField(i, field)
+			}
+			invalid[field] = msg
+		}
+	}
+
+	if len(invalid) > 0 {
+		writeFieldErrors(w, invalid)
+		return
+	}
+
+	// Manual entry sometimes records the same receipt twice; ?force=true
+	// records it anyway.
+	if !grouped && r.URL.Query().Get("force") != "true" {
+		dup, err := findDuplicateSale(ctx, items[0])
+		if err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		if dup != nil {
+			w.Header().Set("Location", fmt.Sprintf("/sales/%d", dup.SaleID))
+			writeError(w, http.StatusConflict, fmt.Sprintf("likely duplicate of sale %d; resend with ?force=true to record it anyway", dup.SaleID))
+			return
+		}
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	if grouped {
+		var groupID int
+		if err := tx.QueryRowContext(ctx, `SELECT nextval('sale_group_seq')`).Scan(&groupID); err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		for i := range items {
+			items[i].SaleGroupID = groupID
+		}
+	}
+
+	var res bulkResult
+	if skip {
+		if res, err = recordSkipping(ctx, tx, items, results); err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		items = res.created()
+	} else {
+		for i := range items {
+			err := recordSale(ctx, tx, &items[i])
+			if err == errInsufficientStock {
+				msg := "not enough stock for this product"
+				if grouped {
+					msg = fmt.Sprintf("item %d: %s", i, msg)
+				}
+				writeError(w, http.StatusConflict, msg)
+				return
+			}
+			if err != nil {
+				writeInternalError(w, err)
+				return
+			}
+		}
+	}
+
+	// A receipt whose items were all skipped records nothing, so a retry
+	// with the same key must not replay it.
+	if key != "" && len(items) > 0 {
+		err := saveIdempotencyKey(ctx, tx, key, items[0].SaleID)
+		if isUniqueViolation(err) {
+			// A concurrent request with the same key won; answer with its sale.
+			tx.Rollback()
+			original, err := findIdempotentSale(ctx, key)
+			if err != nil || original == nil {
+				writeInternalError(w, fmt.Errorf("idempotency key %q conflict: %v", key, err))
+				return
+			}
+			writeReplayedSale(w, r, *original, grouped)
+			return
+		}
+		if err != nil {
+			writeInternalError(w, err)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	for _, item := range items {
+		webhooks.saleCreated(item)
+	}
+
+	if skip {
+		writeJSON(w, http.StatusOK, res)
+		return
+	}
+	if grouped {
+		writeJSON(w, http.StatusCreated, newSaleGroup(items))
+		return
+	}
+	writeJSON(w, http.StatusCreated, items[0])
+}
+
+// writeReplayedSale answers an idempotent replay with what the key first
+// created: the sale itself, or its whole receipt when the request was for
+// a multi-item sale.
+func writeReplayedSale(w http.ResponseWriter, r *http.Request, sale Sale, grouped bool) {
+
+	if !grouped {
+		writeJSON(w, http.StatusOK, sale)
+		return
+	}
+
+	group, err := loadSaleGroup(r.Context(), sale.SaleGroupID)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, group)
+}
+
+// prepareSale resolves the customer and product a sale references and
+// validates the result. It returns the field errors when the sale is invalid.
+// The cost price comes from the product alone, never from the client, and
+// only seedSales may flag a sale as demo data. A receipt is assigned by the
+// server too, after preparation, so a client cannot join someone else's.
+func prepareSale(ctx context.Context, sale *Sale) (map[string]string, error) {
+
+	sale.CostPrice = 0
+	sale.Demo = false
+	sale.SaleGroupID = 0
+
+	if sale.CustomerID != nil {
+		found, err := applyCustomer(ctx, sale)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return map[string]string{"customerId": "unknown customer"}, nil
+		}
+	}
+
+	if sale.ProductID != nil {
+		found, err := applyProduct(ctx, sale)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return map[string]string{"productId": "unknown product"}, nil
+		}
+	}
+
+	sale.PaymentMethod = normalizePaymentMethod(sale.PaymentMethod)
+	sale.Currency = normalizeCurrency(sale.Currency)
+
+	errs := validateSale(*sale)
+	if msg := checkCreatedBy(sale.CreatedBy); msg != "" {
+		if errs == nil {
+			errs = map[string]string{}
+		}
+		errs["createdBy"] = msg
+	}
+	return errs, nil
+}
+
+// recordSale takes a sale's units out of stock, when it references a
+// product, and inserts it within tx.
+func recordSale(ctx context.Context, tx *sql.Tx, sale *Sale) error {
+
+	if sale.ProductID != nil {
+		if err := decrementStock(ctx, tx, *sale.ProductID, sale.Quantity); err != nil {
+			return err
+		}
+	}
+
+	return insertSale(ctx, tx, sale)
+}
+
+// insertSale inserts sale and fills in its generated id, daily sequence
+// number and, unless it already belongs to one, a new sale group. A sale
+// without a CreatedDate is stamped with the current time; either way it is
+// stored as UTC.
+func insertSale(ctx context.Context, tx *sql.Tx, sale *Sale) error {
+
+	if sale.CreatedDate.IsZero() {
+		sale.CreatedDate = time.Now()
+	}
+
+	// Demo sales take no daily number, so seeding and clearing them leaves
+	// the real days' numbering without gaps.
+	if !sale.Demo {
+		seq, err := nextDailySeq(ctx, tx, sale.CreatedDate)
+		if err != nil {
+			return err
+		}
+		sale.DailySeq = seq
+	}
+
+	sale.CreatedDate = sale.CreatedDate.UTC()
+
+	err := tx.QueryRowContext(ctx, `
 		INSERT INTO sales (
+			daily_seq,
 			shop_name,
+			customer_id,
 			customer_name,
+			product_id,
 			product_name,
 			description,
 			cell_name,
 			warranty,
 			quantity,
 			price,
-			payment_method
+			discount,
+			tax_rate,
+			payment_method,
+			currency,
+			created_date,
+			sale_group_id,
+			demo,
+			created_by,
+			cost_price
 		)
-		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)
+		VALUES (NULLIF($1, 0),$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,
+			COALESCE(NULLIF($17, 0), nextval('sale_group_seq')), $18, $19, $20)
+		RETURNING sale_id, net_amount, sale_group_id, version
 	`,
+		sale.DailySeq,
 		sale.ShopName,
+		sale.CustomerID,
 		sale.CustomerName,
+		sale.ProductID,
 		sale.ProductName,
 		sale.Description,
 		sale.CellName,
 		sale.Warranty,
 		sale.Quantity,
 		sale.Price,
+		sale.Discount,
+		sale.TaxRate,
 		sale.PaymentMethod,
-	)
+		sale.Currency,
+		sale.CreatedDate,
+		sale.SaleGroupID,
+		sale.Demo,
+		sale.CreatedBy,
+		sale.CostPrice,
+	).Scan(&sale.SaleID, &sale.NetAmount, &sale.SaleGroupID, &sale.Version)
 
-	if err != nil {
-		http.Error(w, err.Error(), 500)
-		return
-	}
-
-	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Sale Added",
-	})
+	sale.CreatedDate = sale.CreatedDate.In(shopLocation)
+	sale.Status = saleStatusCompleted
+	return err
 }
 
 func deleteSale(w http.ResponseWriter, r *http.Request) {
 
-	id := r.URL.Query().Get("id")
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil || id < 1 {
+		writeError(w, http.StatusBadRequest, "invalid sale id")
+		return
+	}
 
-	_, err := db.Exec("DELETE FROM sales WHERE sale_id=$1", id)
+	_, err = softDeleteSale(r.Context(), id)
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		writeInternalError(w, err)
 		return
 	}
 
-	json.NewEncoder(w).Encode(map[string]string{
+	writeJSON(w, http.StatusOK, map[string]string{
 		"message": "Deleted",
 	})
 }
 
 func resetSales(w http.ResponseWriter, r *http.Request) {
 
-	_, err := db.Exec("TRUNCATE TABLE sales RESTART IDENTITY;")
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	// dryRun reports what a reset would remove without touching anything.
+	if r.URL.Query().Get("dryRun") == "true" {
+		var n int64
+		if err := db.QueryRowContext(r.Context(), "SELECT COUNT(*) FROM sales").Scan(&n); err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"dryRun":          true,
+			"rowsToBeDeleted": n,
+		})
+		return
+	}
+
+	_, err := db.ExecContext(r.Context(), "TRUNCATE TABLE sales, idempotency_keys, daily_sale_counters RESTART IDENTITY")
 	if err != nil {
-		http.Error(w, err.Error(), 500)
+		writeInternalError(w, err)
 		return
 	}
 
-	json.NewEncoder(w).Encode(map[string]string{
+	writeJSON(w, http.StatusOK, map[string]string{
 		"message": "All Sales Reset",
 	})
-}
\ No newline at end of file
+}
+
+// deleteSalesInRange permanently removes the sales created between from and
+// to, for clearing out a test period without a full reset. Both bounds are
+// required so a forgotten parameter cannot wipe the table.
+func deleteSalesInRange(w http.ResponseWriter, r *http.Request) {
+
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	q := r.URL.Query()
+	if q.Get("from") == "" || q.Get("to") == "" {
+		writeError(w, http.StatusBadRequest, "both from and to are required")
+		return
+	}
+
+	var f sqlFilter
+	if err := f.addDateRange(q); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	res, err := db.ExecContext(r.Context(), "DELETE FROM sales "+f.where(), f.args...)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]int64{"rowsDeleted": n})
+}
+
+type paymentMethodUpdate struct {
+	PaymentMethod string `json:"paymentMethod"`
+}
+
+// updatePaymentMethods moves the sales matching the from, to and
+// currentMethod filters to the payment method in the body, for fixing a
+// batch recorded under the wrong one. At least one filter is required so a
+// bare request cannot rewrite every sale.
+func updatePaymentMethods(w http.ResponseWriter, r *http.Request) {
+
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	var req paymentMethodUpdate
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	method := strings.ToUpper(strings.TrimSpace(req.PaymentMethod))
+	if !paymentMethods[method] {
+		writeFieldErrors(w, map[string]string{"paymentMethod": "must be one of CASH, CARD, UPI"})
+		return
+	}
+
+	q := r.URL.Query()
+	if q.Get("from") == "" && q.Get("to") == "" && q.Get("currentMethod") == "" {
+		writeError(w, http.StatusBadRequest, "at least one of from, to and currentMethod is required")
+		return
+	}
+
+	f := activeSales()
+	if err := f.addDateRange(q); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if raw := q.Get("currentMethod"); raw != "" {
+		current := strings.ToUpper(strings.TrimSpace(raw))
+		if !paymentMethods[current] {
+			writeError(w, http.StatusBadRequest, "currentMethod must be one of CASH, CARD, UPI")
+			return
+		}
+		f.add("payment_method = $%d", current)
+	}
+
+	// Rows already at the new method are left alone, so the count is
+	// what actually changed. The rest get a new version like any update.
+	f.add("payment_method IS DISTINCT FROM $%d", method)
+	where := f.where()
+	arg := len(f.args)
+
+	res, err := db.ExecContext(r.Context(), fmt.Sprintf(
+		"UPDATE sales SET payment_method = $%d, version = version + 1 %s", arg, where),
+		f.args...)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]int64{"rowsUpdated": n})
+}
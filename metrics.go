@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// durationBuckets are the upper bounds, in seconds, of the request
+// duration histogram.
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type requestKey struct {
+	handler string
+	status  int
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// metricsRegistry is a minimal in-process collector rendered in the Prometheus
+// text exposition format.
+type metricsRegistry struct {
+	mu        sync.Mutex
+	requests  map[requestKey]uint64
+	durations map[string]*histogram
+}
+
+var metrics = &metricsRegistry{
+	requests:  map[requestKey]uint64{},
+	durations: map[string]*histogram{},
+}
+
+func (m *metricsRegistry) observe(handler string, status int, d time.Duration) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestKey{handler, status}]++
+
+	h, ok := m.durations[handler]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(durationBuckets))}
+		m.durations[handler] = h
+	}
+
+	secs := d.Seconds()
+	for i, le := range durationBuckets {
+		if secs <= le {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += secs
+	h.count++
+}
+
+// instrument records a request count and duration for every request,
+// labelled by the route pattern that served it so per-id paths share one
+// series.
+func instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		_, pattern := http.DefaultServeMux.Handler(r)
+		if pattern == "" {
+			pattern = "unmatched"
+		}
+		metrics.observe(pattern, rec.status, time.Since(start))
+	})
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// getMetrics serves the collected metrics for a Prometheus scrape.
+func getMetrics(w http.ResponseWriter, r *http.Request) {
+
+	var b strings.Builder
+
+	metrics.mu.Lock()
+
+	keys := make([]requestKey, 0, len(metrics.requests))
+	for k := range metrics.requests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].handler != keys[j].handler {
+			return keys[i].handler < keys[j].handler
+		}
+		return keys[i].status < keys[j].status
+	})
+
+	b.WriteString("# HELP http_requests_total Total HTTP requests by handler and status code.\n")
+	b.WriteString("# TYPE http_requests_total counter\n")
+	for _, k := range keys {
+		fmt.Fprintf(&b, "http_requests_total{handler=\"%s\",status=\"%d\"} %d\n",
+			labelEscaper.Replace(k.handler), k.status, metrics.requests[k])
+	}
+
+	handlers := make([]string, 0, len(metrics.durations))
+	for h := range metrics.durations {
+		handlers = append(handlers, h)
+	}
+	sort.Strings(handlers)
+
+	b.WriteString("# HELP http_request_duration_seconds HTTP request latency by handler.\n")
+	b.WriteString("# TYPE http_request_duration_seconds histogram\n")
+	for _, name := range handlers {
+		h := metrics.durations[name]
+		label := labelEscaper.Replace(name)
+
+		var cumulative uint64
+		for i, le := range durationBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(&b, "http_request_duration_seconds_bucket{handler=\"%s\",le=\"%s\"} %d\n", label, formatFloat(le), cumulative)
+		}
+		fmt.Fprintf(&b, "http_request_duration_seconds_bucket{handler=\"%s\",le=\"+Inf\"} %d\n", label, h.count)
+		fmt.Fprintf(&b, "http_request_duration_seconds_sum{handler=\"%s\"} %s\n", label, formatFloat(h.sum))
+		fmt.Fprintf(&b, "http_request_duration_seconds_count{handler=\"%s\"} %d\n", label, h.count)
+	}
+
+	metrics.mu.Unlock()
+
+	stats := db.Stats()
+
+	b.WriteString("# HELP db_open_connections Open database connections, in use or idle.\n")
+	b.WriteString("# TYPE db_open_connections gauge\n")
+	fmt.Fprintf(&b, "db_open_connections %d\n", stats.OpenConnections)
+	b.WriteString("# HELP db_in_use_connections Database connections currently in use.\n")
+	b.WriteString("# TYPE db_in_use_connections gauge\n")
+	fmt.Fprintf(&b, "db_in_use_connections %d\n", stats.InUse)
+	b.WriteString("# HELP db_wait_count_total Connections waited for because the pool was exhausted.\n")
+	b.WriteString("# TYPE db_wait_count_total counter\n")
+	fmt.Fprintf(&b, "db_wait_count_total %d\n", stats.WaitCount)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write([]byte(b.String()))
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	rec.status = code
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g.
+// to flush streamed responses.
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// logRequests logs one key=value line per request once it completes.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		slog.InfoContext(r.Context(), "request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"durationMs", time.Since(start).Milliseconds(),
+		)
+	})
+}
+
+// recoverPanics turns a panicking handler into a 500 response instead of a
+// dropped connection.
+func recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+
+			slog.ErrorContext(r.Context(), "panic",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"err", fmt.Sprint(err),
+				"stack", string(debug.Stack()),
+			)
+			writeError(w, http.StatusInternalServerError, "internal server error")
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestTimeout is the deadline given to each request's context.
+var requestTimeout = 5 * time.Second
+
+// streamingPaths are exempt from requestTimeout and the server's read and
+// write timeouts because their requests or responses may legitimately take
+// longer to transfer. They still stop when the client disconnects.
+var streamingPaths = map[string]bool{
+	"/sales/export.csv": true,
+	"/sales/stream":     true,
+	"/sales/import":     true,
+}
+
+// withTimeout bounds every request's context by requestTimeout, so
+// database calls made with r.Context() are cancelled together.
+func withTimeout(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if streamingPaths[r.URL.Path] {
+			// A zero deadline means none.
+			rc := http.NewResponseController(w)
+			rc.SetReadDeadline(time.Time{})
+			rc.SetWriteDeadline(time.Time{})
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), requestTimeout)
+		defer cancel()
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// newHandler wraps mux in the middleware every request passes through.
+func newHandler(mux *http.ServeMux) http.Handler {
+	return withRequestID(logRequests(instrument(withGzip(recoverPanics(withCORS(withBasicAuth(withTimeout(withPrettyJSON(jsonMuxErrors(mux))))))))))
+}
+
+// jsonMuxErrors answers the requests mux would reject itself, such as a
+// known path with the wrong method, with the usual JSON error envelope
+// instead of the mux's plain-text body. The Allow header the mux computes
+// is kept.
+func jsonMuxErrors(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		// Only mux.ServeHTTP sets the path values, so a matched request
+		// must go through it rather than the handler Handler returns.
+		h, pattern := mux.Handler(r)
+		if pattern != "" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &headerRecorder{header: http.Header{}, status: http.StatusOK}
+		h.ServeHTTP(rec, r)
+
+		// Every path answers GET through the static catch-all, so a write
+		// to a path nothing else knows is a missing route, not a wrong
+		// method.
+		if rec.status == http.StatusMethodNotAllowed {
+			probe := r.Clone(r.Context())
+			probe.Method = http.MethodGet
+			if _, p := mux.Handler(probe); p == staticPattern {
+				writeError(w, http.StatusNotFound, "not found")
+				return
+			}
+		}
+
+		if allow := rec.header.Get("Allow"); allow != "" {
+			w.Header().Set("Allow", allow)
+		}
+		writeError(w, rec.status, strings.ToLower(http.StatusText(rec.status)))
+	})
+}
+
+// headerRecorder keeps the headers and status a handler writes and
+// discards its body.
+type headerRecorder struct {
+	header http.Header
+	status int
+}
+
+func (rec *headerRecorder) Header() http.Header { return rec.header }
+
+func (rec *headerRecorder) Write(b []byte) (int, error) { return len(b), nil }
+
+func (rec *headerRecorder) WriteHeader(code int) { rec.status = code }
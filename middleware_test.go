@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestHandlerPathValues(t *testing.T) {
+
+	requestTimeout = time.Second
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /sales/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, ok := pathID(w, r, "sale")
+		if !ok {
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"id": strconv.Itoa(id)})
+	})
+	h := newHandler(mux)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/sales/42", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Data map[string]string `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data["id"] != "42" {
+		t.Errorf("id = %q, want 42", resp.Data["id"])
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/sales/42", nil))
+
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("status = %d, want 405", rec.Code)
+	}
+	if allow := rec.Header().Get("Allow"); allow == "" {
+		t.Error("Allow header missing")
+	}
+}
+
+func TestHandlerUnknownWritePath(t *testing.T) {
+
+	requestTimeout = time.Second
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /sales/create", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusCreated, nil)
+	})
+	mux.Handle(staticPattern, http.NotFoundHandler())
+	h := newHandler(mux)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/sales/craete", nil))
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404", rec.Code)
+	}
+	if allow := rec.Header().Get("Allow"); allow != "" {
+		t.Errorf("Allow = %q, want none", allow)
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// localCreatedDate is replaced in migration SQL by createdDateLocal, so a
+// backfill of per-day data agrees with the days nextDailySeq uses.
+const localCreatedDate = "{{localCreatedDate}}"
+
+// migration is one step in the schema's history. Migrations are applied in
+// version order and each runs exactly once per database. sql may use the
+// localCreatedDate placeholder.
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+// migrations lists every schema change. Append new entries with the next
+// version number; never edit or reorder one that has shipped. The early
+// entries are idempotent because they predate schema_migrations and may
+// find their changes already in place.
+var migrations = []migration{
+	{1, "create sales", `
+		CREATE TABLE IF NOT EXISTS sales (
+			sale_id SERIAL PRIMARY KEY,
+			shop_name TEXT,
+			customer_name TEXT,
+			product_name TEXT,
+			description TEXT,
+			cell_name TEXT,
+			warranty TEXT,
+			quantity INT,
+			price NUMERIC(10,2),
+			payment_method TEXT,
+			created_date TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+		ALTER TABLE sales ADD COLUMN IF NOT EXISTS shop_name TEXT;
+		ALTER TABLE sales ADD COLUMN IF NOT EXISTS description TEXT;
+	`},
+	{2, "store created_date as timestamptz", `
+		DO $$
+		BEGIN
+			IF EXISTS (
+				SELECT 1 FROM information_schema.columns
+				WHERE table_name = 'sales'
+				  AND column_name = 'created_date'
+				  AND data_type = 'timestamp without time zone'
+			) THEN
+				ALTER TABLE sales
+					ALTER COLUMN created_date TYPE TIMESTAMPTZ
+					USING created_date AT TIME ZONE 'UTC';
+			END IF;
+		END $$;
+	`},
+	{3, "create products", `
+		CREATE TABLE IF NOT EXISTS products (
+			id SERIAL PRIMARY KEY,
+			name TEXT NOT NULL UNIQUE,
+			default_price NUMERIC(10,2) NOT NULL DEFAULT 0
+		);
+		ALTER TABLE products ADD COLUMN IF NOT EXISTS stock INT NOT NULL DEFAULT 0;
+		ALTER TABLE sales ADD COLUMN IF NOT EXISTS product_id INT REFERENCES products(id) ON DELETE SET NULL;
+	`},
+	{4, "soft-delete sales", `
+		ALTER TABLE sales ADD COLUMN deleted_at TIMESTAMPTZ;
+	`},
+	{5, "create idempotency_keys", `
+		CREATE TABLE idempotency_keys (
+			key TEXT PRIMARY KEY,
+			sale_id INT NOT NULL REFERENCES sales(sale_id) ON DELETE CASCADE,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		);
+	`},
+	{6, "add discount and tax_rate", `
+		ALTER TABLE sales ADD COLUMN discount NUMERIC(10,2) NOT NULL DEFAULT 0;
+		ALTER TABLE sales ADD COLUMN tax_rate NUMERIC(5,4) NOT NULL DEFAULT 0;
+		ALTER TABLE sales ADD COLUMN net_amount NUMERIC(12,2)
+			GENERATED ALWAYS AS ((price * quantity - discount) * (1 + tax_rate)) STORED;
+	`},
+	{7, "create customers", `
+		CREATE TABLE customers (
+			id SERIAL PRIMARY KEY,
+			name TEXT NOT NULL UNIQUE,
+			phone TEXT,
+			email TEXT,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		);
+		ALTER TABLE sales ADD COLUMN customer_id INT REFERENCES customers(id) ON DELETE SET NULL;
+	`},
+	{8, "refund sales", `
+		ALTER TABLE sales ADD COLUMN refunded_at TIMESTAMPTZ;
+		ALTER TABLE sales ADD COLUMN refund_reason TEXT;
+	`},
+	{9, "normalize payment_method", `
+		UPDATE sales SET payment_method = UPPER(TRIM(payment_method))
+		WHERE payment_method <> UPPER(TRIM(payment_method));
+		UPDATE sales SET payment_method = 'CASH'
+		WHERE payment_method IS NULL OR payment_method = '';
+		ALTER TABLE sales ALTER COLUMN payment_method SET DEFAULT 'CASH';
+	`},
+	{10, "add currency", `
+		ALTER TABLE sales ADD COLUMN currency TEXT NOT NULL DEFAULT 'INR';
+	`},
+	{11, "number sales per day", `
+		CREATE TABLE daily_sale_counters (
+			day DATE PRIMARY KEY,
+			last_seq INT NOT NULL
+		);
+		ALTER TABLE sales ADD COLUMN daily_seq INT;
+		UPDATE sales SET daily_seq = numbered.seq
+		FROM (
+			SELECT sale_id, ROW_NUMBER() OVER (
+				PARTITION BY {{localCreatedDate}}::date
+				ORDER BY created_date, sale_id
+			) AS seq
+			FROM sales
+		) numbered
+		WHERE sales.sale_id = numbered.sale_id;
+		INSERT INTO daily_sale_counters (day, last_seq)
+		SELECT {{localCreatedDate}}::date, MAX(daily_seq)
+		FROM sales
+		GROUP BY 1;
+	`},
+	{12, "group sales into receipts", `
+		CREATE SEQUENCE sale_group_seq;
+		ALTER TABLE sales ADD COLUMN sale_group_id INT;
+		UPDATE sales SET sale_group_id = sale_id;
+		SELECT setval('sale_group_seq', COALESCE(MAX(sale_id), 0) + 1, false) FROM sales;
+		ALTER TABLE sales ALTER COLUMN sale_group_id SET DEFAULT nextval('sale_group_seq');
+		ALTER TABLE sales ALTER COLUMN sale_group_id SET NOT NULL;
+		CREATE INDEX sales_sale_group_id_idx ON sales (sale_group_id);
+	`},
+	{13, "track product price history", `
+		CREATE TABLE product_price_history (
+			id SERIAL PRIMARY KEY,
+			product_id INT NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+			price NUMERIC(10,2) NOT NULL,
+			effective_from TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		);
+		CREATE INDEX product_price_history_product_idx
+			ON product_price_history (product_id, effective_from);
+		INSERT INTO product_price_history (product_id, price)
+		SELECT id, default_price FROM products;
+		CREATE FUNCTION record_product_price() RETURNS trigger AS $$
+		BEGIN
+			IF TG_OP = 'INSERT' OR NEW.default_price IS DISTINCT FROM OLD.default_price THEN
+				INSERT INTO product_price_history (product_id, price)
+				VALUES (NEW.id, NEW.default_price);
+			END IF;
+			RETURN NEW;
+		END $$ LANGUAGE plpgsql;
+		CREATE TRIGGER products_price_history
+			AFTER INSERT OR UPDATE OF default_price ON products
+			FOR EACH ROW EXECUTE FUNCTION record_product_price();
+	`},
+	{14, "flag demo sales", `
+		ALTER TABLE sales ADD COLUMN demo BOOLEAN NOT NULL DEFAULT false;
+	`},
+	{15, "attribute sales to staff", `
+		ALTER TABLE sales ADD COLUMN created_by TEXT NOT NULL DEFAULT 'unknown';
+	`},
+	{16, "version sales", `
+		ALTER TABLE sales ADD COLUMN version INT NOT NULL DEFAULT 1;
+	`},
+	{17, "track cost prices", `
+		ALTER TABLE products ADD COLUMN cost_price NUMERIC(10,2) NOT NULL DEFAULT 0;
+		ALTER TABLE sales ADD COLUMN cost_price NUMERIC(10,2) NOT NULL DEFAULT 0;
+	`},
+}
+
+// migrationLockID is the advisory lock key that serialises migrations when
+// several instances start at once.
+const migrationLockID = 7263541
+
+// migrate applies every migration not yet recorded in schema_migrations,
+// each in its own transaction.
+func migrate() error {
+
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INT PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if err := applyMigration(m); err != nil {
+			return fmt.Errorf("migration %d (%s): %v", m.version, m.name, err)
+		}
+	}
+
+	return nil
+}
+
+func applyMigration(m migration) error {
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, migrationLockID); err != nil {
+		return err
+	}
+
+	var applied int
+	err = tx.QueryRow(`SELECT version FROM schema_migrations WHERE version = $1`, m.version).Scan(&applied)
+	if err == nil {
+		return nil
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	// Backfills bucket by the same local day as the running service.
+	query := strings.ReplaceAll(m.sql, localCreatedDate, createdDateLocal)
+	if _, err := tx.Exec(query); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.version, m.name)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	slog.Info("applied migration", "version", m.version, "name", m.name)
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"math"
+	"strconv"
+)
+
+// money is an amount in a sale's currency. Amounts are stored as
+// NUMERIC with two decimals, but arithmetic on float64 can leave them a
+// hair off (1.10 * 3 is 3.3000000000000003), so money always serializes
+// rounded to the cent and what clients see matches what is stored.
+//
+// database/sql scans NUMERIC into money and passes it as a query argument
+// the same way it does float64.
+type money float64
+
+// cents rounds m to two decimals.
+func (m money) cents() money {
+	r := math.Round(float64(m)*100) / 100
+	if r == 0 {
+		return 0 // not -0
+	}
+	return money(r)
+}
+
+func (m money) MarshalJSON() ([]byte, error) {
+	return strconv.AppendFloat(nil, float64(m.cents()), 'f', -1, 64), nil
+}
+
+// String formats m with exactly two decimals, for CSV and invoices.
+func (m money) String() string {
+	return strconv.FormatFloat(float64(m.cents()), 'f', 2, 64)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// openAPISpec is the hand-written OpenAPI 3 description of the API. Keep
+// it in step with the handlers when routes or shapes change.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// getOpenAPISpec serves the spec as-is, outside the response envelope, so
+// client generators can consume it directly.
+func getOpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
+
+type apiEndpoint struct {
+	Method  string `json:"method"`
+	Path    string `json:"path"`
+	Summary string `json:"summary"`
+}
+
+type apiIndex struct {
+	Service   string        `json:"service"`
+	Version   string        `json:"version"`
+	Docs      string        `json:"docs"`
+	Endpoints []apiEndpoint `json:"endpoints"`
+}
+
+// apiEndpoints lists the operations in openAPISpec, in spec order, so the
+// index never drifts from the documented routes.
+var apiEndpoints = sync.OnceValue(func() []apiEndpoint {
+
+	var spec struct {
+		Paths specPaths `json:"paths"`
+	}
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		slog.Error("parse embedded OpenAPI spec", "err", err)
+		return []apiEndpoint{}
+	}
+	return spec.Paths
+})
+
+// specPaths decodes the OpenAPI paths object, keeping the order the spec lists
+// the paths in, which encoding/json loses for maps.
+type specPaths []apiEndpoint
+
+func (p *specPaths) UnmarshalJSON(b []byte) error {
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		path := tok.(string)
+
+		// A path item also holds shared parameters next to the operations.
+		var item map[string]json.RawMessage
+		if err := dec.Decode(&item); err != nil {
+			return err
+		}
+		for _, method := range []string{"get", "post", "put", "patch", "delete"} {
+			raw, ok := item[method]
+			if !ok {
+				continue
+			}
+			var op struct {
+				Summary string `json:"summary"`
+			}
+			if err := json.Unmarshal(raw, &op); err != nil {
+				return err
+			}
+			*p = append(*p, apiEndpoint{Method: strings.ToUpper(method), Path: path, Summary: op.Summary})
+		}
+	}
+	return nil
+}
+
+// getAPIIndex answers GET / when there is no frontend to serve, pointing
+// API consumers at what the service offers.
+func getAPIIndex(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, apiIndex{
+		Service:   "Shop backend API",
+		Version:   version,
+		Docs:      "/openapi.json",
+		Endpoints: apiEndpoints(),
+	})
+}
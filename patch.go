@@ -0,0 +1,191 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// salePatch holds the fields a PATCH may change. A nil field is left as it
+// is; only the fields present in the body are written.
+type salePatch struct {
+	ShopName      *string  `json:"shopName"`
+	CustomerName  *string  `json:"customerName"`
+	ProductName   *string  `json:"productName"`
+	Description   *string  `json:"description"`
+	CellName      *string  `json:"cellName"`
+	Warranty      *string  `json:"warranty"`
+	Quantity      *int     `json:"quantity"`
+	Price         *money   `json:"price"`
+	Discount      *money   `json:"discount"`
+	TaxRate       *float64 `json:"taxRate"`
+	PaymentMethod *string  `json:"paymentMethod"`
+	Currency      *string  `json:"currency"`
+
+	// Version is the version the patch was based on, unless If-Match is sent.
+	Version int `json:"version"`
+}
+
+// empty reports whether the patch sets no field.
+func (p salePatch) empty() bool {
+	return p.ShopName == nil && p.CustomerName == nil && p.ProductName == nil &&
+		p.Description == nil && p.CellName == nil && p.Warranty == nil &&
+		p.Quantity == nil && p.Price == nil && p.Discount == nil &&
+		p.TaxRate == nil && p.PaymentMethod == nil && p.Currency == nil
+}
+
+// patchSale applies a partial update. The patch is merged onto the current
+// row and the result validated as a whole, so a lone discount is still
+// checked against the stored price and quantity. The row must still be at
+// the version the client read, or the patch is refused with 409.
+func patchSale(w http.ResponseWriter, r *http.Request) {
+
+	id, ok := pathID(w, r, "sale")
+	if !ok {
+		return
+	}
+
+	var patch salePatch
+	if !decodeJSON(w, r, &patch) {
+		return
+	}
+
+	// An empty patch is malformed whatever version it names.
+	if patch.empty() {
+		writeError(w, http.StatusBadRequest, "patch must set at least one field")
+		return
+	}
+
+	version, err := expectedVersion(r, patch.Version)
+	if err != nil {
+		writeVersionError(w, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	sale, err := scanSale(tx.QueryRowContext(ctx, `
+		SELECT `+saleColumns+`
+		FROM sales
+		WHERE sale_id = $1 AND deleted_at IS NULL
+		FOR UPDATE
+	`, id))
+	if err == sql.ErrNoRows {
+		writeError(w, http.StatusNotFound, "sale not found")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	// A version of 0 (If-Match: *) matches whatever is stored.
+	if version != 0 && version != sale.Version {
+		writeVersionConflict(w, sale.Version)
+		return
+	}
+
+	original := sale
+
+	var sets []string
+	var args []interface{}
+	set := func(column string, v interface{}) {
+		args = append(args, v)
+		sets = append(sets, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+
+	if patch.ShopName != nil {
+		sale.ShopName = *patch.ShopName
+		set("shop_name", sale.ShopName)
+	}
+	if patch.CustomerName != nil {
+		sale.CustomerName = *patch.CustomerName
+		set("customer_name", sale.CustomerName)
+	}
+	if patch.ProductName != nil {
+		sale.ProductName = *patch.ProductName
+		set("product_name", sale.ProductName)
+	}
+	if patch.Description != nil {
+		sale.Description = *patch.Description
+		set("description", sale.Description)
+	}
+	if patch.CellName != nil {
+		sale.CellName = *patch.CellName
+		set("cell_name", sale.CellName)
+	}
+	if patch.Warranty != nil {
+		sale.Warranty = *patch.Warranty
+		set("warranty", sale.Warranty)
+	}
+	if patch.Quantity != nil {
+		sale.Quantity = *patch.Quantity
+		set("quantity", sale.Quantity)
+	}
+	if patch.Price != nil {
+		sale.Price = *patch.Price
+		set("price", sale.Price)
+	}
+	if patch.Discount != nil {
+		sale.Discount = *patch.Discount
+		set("discount", sale.Discount)
+	}
+	if patch.TaxRate != nil {
+		sale.TaxRate = *patch.TaxRate
+		set("tax_rate", sale.TaxRate)
+	}
+	if patch.PaymentMethod != nil {
+		sale.PaymentMethod = normalizePaymentMethod(*patch.PaymentMethod)
+		set("payment_method", sale.PaymentMethod)
+	}
+	if patch.Currency != nil {
+		sale.Currency = normalizeCurrency(*patch.Currency)
+		set("currency", sale.Currency)
+	}
+
+	if errs := validateSale(sale); errs != nil {
+		writeFieldErrors(w, errs)
+		return
+	}
+
+	if patch.Quantity != nil {
+		err := changeSoldQuantity(ctx, tx, original, sale.Quantity)
+		if err == errInsufficientStock {
+			writeError(w, http.StatusConflict, "not enough stock for this product")
+			return
+		}
+		if err != nil {
+			writeInternalError(w, err)
+			return
+		}
+	}
+
+	sets = append(sets, "version = version + 1")
+	args = append(args, id)
+
+	updated, err := scanSale(tx.QueryRowContext(ctx, fmt.Sprintf(`
+		UPDATE sales SET %s
+		WHERE sale_id = $%d
+		RETURNING %s
+	`, strings.Join(sets, ", "), len(args), saleColumns), args...))
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", saleETag(updated.Version))
+	writeJSON(w, http.StatusOK, updated)
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type Product struct {
+	ID           int    `json:"id"`
+	Name         string `json:"name"`
+	DefaultPrice money  `json:"defaultPrice"`
+	CostPrice    money  `json:"costPrice"`
+	Stock        int    `json:"stock"`
+}
+
+func listProducts(w http.ResponseWriter, r *http.Request) {
+
+	rows, err := db.QueryContext(r.Context(), `SELECT id, name, default_price, cost_price, stock FROM products ORDER BY name`)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer rows.Close()
+
+	list := []Product{}
+
+	for rows.Next() {
+		var p Product
+		if err := rows.Scan(&p.ID, &p.Name, &p.DefaultPrice, &p.CostPrice, &p.Stock); err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		list = append(list, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+func createProduct(w http.ResponseWriter, r *http.Request) {
+
+	var p Product
+	if !decodeJSON(w, r, &p) {
+		return
+	}
+
+	p.Name = strings.TrimSpace(p.Name)
+
+	errs := map[string]string{}
+	if p.Name == "" {
+		errs["name"] = "is required"
+	}
+	if p.DefaultPrice < 0 {
+		errs["defaultPrice"] = "must not be negative"
+	}
+	if p.CostPrice < 0 {
+		errs["costPrice"] = "must not be negative"
+	}
+	if p.Stock < 0 {
+		errs["stock"] = "must not be negative"
+	}
+	if len(errs) > 0 {
+		writeFieldErrors(w, errs)
+		return
+	}
+
+	err := db.QueryRowContext(r.Context(), `
+		INSERT INTO products (name, default_price, cost_price, stock)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, p.Name, p.DefaultPrice, p.CostPrice, p.Stock).Scan(&p.ID)
+
+	if isUniqueViolation(err) {
+		writeError(w, http.StatusConflict, "a product with that name already exists")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, p)
+}
+
+func deleteProduct(w http.ResponseWriter, r *http.Request) {
+
+	id, ok := pathID(w, r, "product")
+	if !ok {
+		return
+	}
+
+	res, err := db.ExecContext(r.Context(), "DELETE FROM products WHERE id=$1", id)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if n == 0 {
+		writeError(w, http.StatusNotFound, "product not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"message": "Deleted",
+	})
+}
+
+// productPrice is one entry in a product's price history: the price that
+// applied from EffectiveFrom until the next entry.
+type productPrice struct {
+	Price         money     `json:"price"`
+	EffectiveFrom time.Time `json:"effectiveFrom"`
+}
+
+// getProductPriceHistory lists a product's prices, newest first. Entries
+// are written by a trigger on products, so changes made outside the API
+// are recorded too. Sales keep the price they were made at regardless.
+func getProductPriceHistory(w http.ResponseWriter, r *http.Request) {
+
+	id, ok := pathID(w, r, "product")
+	if !ok {
+		return
+	}
+
+	var exists bool
+	err := db.QueryRowContext(r.Context(), `SELECT EXISTS (SELECT 1 FROM products WHERE id = $1)`, id).Scan(&exists)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	if !exists {
+		writeError(w, http.StatusNotFound, "product not found")
+		return
+	}
+
+	rows, err := db.QueryContext(r.Context(), `
+		SELECT price, effective_from
+		FROM product_price_history
+		WHERE product_id = $1
+		ORDER BY effective_from DESC, id DESC
+	`, id)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer rows.Close()
+
+	history := []productPrice{}
+
+	for rows.Next() {
+		var p productPrice
+		if err := rows.Scan(&p.Price, &p.EffectiveFrom); err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		p.EffectiveFrom = p.EffectiveFrom.In(shopLocation)
+		history = append(history, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, history)
+}
+
+// applyProduct fills in a sale's product name and price from the product it
+// references, and snapshots the product's current cost price so later
+// changes to it leave the sale's profit alone. It reports false when the
+// product does not exist.
+func applyProduct(ctx context.Context, sale *Sale) (bool, error) {
+
+	var name string
+	var price money
+
+	err := db.QueryRowContext(ctx, `SELECT name, default_price, cost_price FROM products WHERE id=$1`, *sale.ProductID).
+		Scan(&name, &price, &sale.CostPrice)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if strings.TrimSpace(sale.ProductName) == "" {
+		sale.ProductName = name
+	}
+
+	// A zero price means the client left it out.
+	if sale.Price == 0 {
+		sale.Price = price
+	}
+
+	return true, nil
+}
+
+// changeSoldQuantity moves the difference between sale's stored quantity
+// and qty out of or back into its product's stock within tx, refusing with
+// errInsufficientStock like decrementStock. A sale without a product
+// tracks no stock, and a refunded one has already returned its units.
+func changeSoldQuantity(ctx context.Context, tx *sql.Tx, sale Sale, qty int) error {
+
+	if sale.ProductID == nil || sale.RefundedAt != nil || qty == sale.Quantity {
+		return nil
+	}
+
+	if qty > sale.Quantity {
+		return decrementStock(ctx, tx, *sale.ProductID, qty-sale.Quantity)
+	}
+
+	_, err := tx.ExecContext(ctx, `UPDATE products SET stock = stock + $1 WHERE id = $2`, sale.Quantity-qty, *sale.ProductID)
+	return err
+}
+
+// errInsufficientStock is returned by decrementStock when the product does
+// not have enough units left for the sale.
+var errInsufficientStock = errors.New("insufficient stock")
+
+// decrementStock takes qty units of a product out of stock within tx. The
+// conditional UPDATE locks the product row, so concurrent sales of the same
+// product cannot both succeed against the last units.
+func decrementStock(ctx context.Context, tx *sql.Tx, productID, qty int) error {
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE products SET stock = stock - $1
+		WHERE id = $2 AND stock >= $1
+	`, qty, productID)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errInsufficientStock
+	}
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// sqlFilter accumulates WHERE conditions together with their bound
+// arguments so handlers can compose optional filters without
+// string-concatenating user input into SQL.
+type sqlFilter struct {
+	conds []string
+	args  []interface{}
+}
+
+// add appends a condition. cond is a format string whose %d verbs are
+// replaced with the placeholder number assigned to arg.
+func (f *sqlFilter) add(cond string, arg interface{}) {
+	f.args = append(f.args, arg)
+	f.conds = append(f.conds, fmt.Sprintf(cond, len(f.args)))
+}
+
+// cond appends a condition that takes no arguments.
+func (f *sqlFilter) cond(cond string) {
+	f.conds = append(f.conds, cond)
+}
+
+// activeSales returns a filter that excludes soft-deleted sales, the
+// starting point for every query over live data.
+func activeSales() sqlFilter {
+	var f sqlFilter
+	f.cond("deleted_at IS NULL")
+	return f
+}
+
+// revenueSales narrows activeSales to the sales that count towards
+// revenue, leaving out refunds.
+func revenueSales() sqlFilter {
+	f := activeSales()
+	f.cond("refunded_at IS NULL")
+	return f
+}
+
+// addCurrency scopes a revenue query to the currency query parameter,
+// INR when absent, so amounts in different currencies are never summed.
+func (f *sqlFilter) addCurrency(q url.Values) error {
+
+	currency := normalizeCurrency(q.Get("currency"))
+	if !currencies[currency] {
+		return fmt.Errorf("currency must be one of %s", currencyList())
+	}
+
+	f.add("currency = $%d", currency)
+	return nil
+}
+
+// arg binds a value that is not part of the WHERE clause (LIMIT, OFFSET)
+// and returns its placeholder.
+func (f *sqlFilter) arg(v interface{}) string {
+	f.args = append(f.args, v)
+	return fmt.Sprintf("$%d", len(f.args))
+}
+
+func (f *sqlFilter) where() string {
+	if len(f.conds) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(f.conds, " AND ")
+}
+
+// createdDateLocal converts created_date to the shop's local wall-clock time
+// for bucketing. setShopLocation keeps it in step with shopLocation.
+var createdDateLocal = "(created_date AT TIME ZONE 'Asia/Kolkata')"
+
+// addDateRange parses the optional from/to query parameters and adds them
+// as bounds on created_date. Either bound may be omitted. Values are
+// RFC3339 timestamps or YYYY-MM-DD dates, the latter taken as local midnight;
+// a date-only "to" includes the whole of that day.
+func (f *sqlFilter) addDateRange(q url.Values) error {
+
+	if raw := q.Get("from"); raw != "" {
+		from, _, err := parseDateParam(raw)
+		if err != nil {
+			return fmt.Errorf("from: %v", err)
+		}
+		f.add("created_date >= $%d", from.UTC())
+	}
+
+	if raw := q.Get("to"); raw != "" {
+		to, dateOnly, err := parseDateParam(raw)
+		if err != nil {
+			return fmt.Errorf("to: %v", err)
+		}
+		if dateOnly {
+			to = to.AddDate(0, 0, 1)
+		}
+		f.add("created_date < $%d", to.UTC())
+	}
+
+	return nil
+}
+
+func parseDateParam(raw string) (t time.Time, dateOnly bool, err error) {
+
+	if t, err = time.Parse(time.RFC3339, raw); err == nil {
+		return t, false, nil
+	}
+
+	if t, err = time.ParseInLocation("2006-01-02", raw, shopLocation); err == nil {
+		return t, true, nil
+	}
+
+	return time.Time{}, false, fmt.Errorf("%q is not an RFC3339 timestamp or YYYY-MM-DD date", raw)
+}
+
+// likeEscaper escapes the LIKE wildcards so user input matches literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// isUniqueViolation reports whether err is a Postgres unique_violation.
+func isUniqueViolation(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == "23505"
+}
+
+// isDataError reports whether err is a Postgres data exception or integrity
+// constraint violation, i.e. the row was at fault rather than the database.
+func isDataError(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && (pqErr.Code.Class() == "22" || pqErr.Code.Class() == "23")
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimiterGCInterval is how often idle client buckets are dropped.
+const rateLimiterGCInterval = time.Minute
+
+// rateLimiter is a per-client token bucket. Each client may make burst
+// requests at once, refilled at rate requests per second.
+type rateLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+
+	l := &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: map[string]*tokenBucket{},
+	}
+
+	go func() {
+		for range time.Tick(rateLimiterGCInterval) {
+			l.gc()
+		}
+	}()
+
+	return l
+}
+
+// allow takes a token from key's bucket. When none is left it reports how
+// long until the next one is available.
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+
+	b.tokens--
+	return true, 0
+}
+
+// gc drops buckets that have refilled completely; a fresh bucket would be
+// identical, so forgetting them loses nothing.
+func (l *rateLimiter) gc() {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	for key, b := range l.buckets {
+		if time.Since(b.last) > full {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// limit rejects requests from clients that are over their rate with a 429.
+func (l *rateLimiter) limit(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		ok, wait := l.allow(clientIP(r))
+		if !ok {
+			secs := int(math.Ceil(wait.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(secs))
+			writeError(w, http.StatusTooManyRequests, "too many requests")
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// trustedProxies are the proxies, from TRUSTED_PROXIES, whose
+// X-Forwarded-For entries are believed. With none, the header is ignored.
+var trustedProxies []netip.Prefix
+
+// clientIP identifies the caller. X-Forwarded-For is only consulted when
+// the connection comes from a trusted proxy, and then read from the right:
+// the left-most entries are whatever the client chose to send, while each
+// trusted proxy appends the address it saw. The first untrusted address is
+// the caller.
+func clientIP(r *http.Request) string {
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	if !isTrustedProxy(host) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if !isTrustedProxy(hop) {
+			return hop
+		}
+		host = hop
+	}
+	return host
+}
+
+func isTrustedProxy(ip string) bool {
+
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range trustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+)
+
+// readOnly blocks every write route while set. It starts from READ_ONLY
+// and can be flipped at runtime through /admin/read-only, so migrations
+// can run while the dashboard stays readable.
+var readOnly atomic.Bool
+
+type readOnlyState struct {
+	ReadOnly bool `json:"readOnly"`
+}
+
+// unlessReadOnly wraps a write handler so it answers 503 while the service
+// is read-only.
+func unlessReadOnly(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		if readOnly.Load() {
+			writeError(w, http.StatusServiceUnavailable, "service is read-only")
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func getReadOnly(w http.ResponseWriter, r *http.Request) {
+
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, readOnlyState{ReadOnly: readOnly.Load()})
+}
+
+// setReadOnly switches read-only mode on or off and logs the change.
+func setReadOnly(w http.ResponseWriter, r *http.Request) {
+
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	var req struct {
+		ReadOnly *bool `json:"readOnly"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.ReadOnly == nil {
+		writeFieldErrors(w, map[string]string{"readOnly": "is required"})
+		return
+	}
+
+	if was := readOnly.Swap(*req.ReadOnly); was != *req.ReadOnly {
+		slog.InfoContext(r.Context(), "read-only mode toggled", "readOnly", *req.ReadOnly, "client", clientIP(r))
+	}
+
+	writeJSON(w, http.StatusOK, readOnlyState{ReadOnly: *req.ReadOnly})
+}
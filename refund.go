@@ -0,0 +1,86 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+)
+
+// maxRefundReasonLength bounds the free-text reason stored with a refund.
+const maxRefundReasonLength = 500
+
+type refundRequest struct {
+	Reason string `json:"reason"`
+}
+
+// refundSale marks a sale as refunded and, when it was sold from a tracked
+// product, puts the quantity back into stock. The sale stays listed but no
+// longer counts towards revenue.
+func refundSale(w http.ResponseWriter, r *http.Request) {
+
+	id, ok := pathID(w, r, "sale")
+	if !ok {
+		return
+	}
+
+	var req refundRequest
+	if r.ContentLength != 0 && !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if len(req.Reason) > maxRefundReasonLength {
+		writeFieldErrors(w, map[string]string{"reason": "must be at most 500 characters"})
+		return
+	}
+
+	ctx := r.Context()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx, `
+		UPDATE sales SET refunded_at = NOW(), refund_reason = NULLIF($2, ''), version = version + 1
+		WHERE sale_id = $1 AND deleted_at IS NULL AND refunded_at IS NULL
+		RETURNING `+saleColumns, id, req.Reason)
+
+	sale, err := scanSale(row)
+	if err == sql.ErrNoRows {
+		var refunded bool
+		err = tx.QueryRowContext(ctx, `
+			SELECT refunded_at IS NOT NULL FROM sales
+			WHERE sale_id = $1 AND deleted_at IS NULL
+		`, id).Scan(&refunded)
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "sale not found")
+			return
+		}
+		if err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		writeError(w, http.StatusConflict, "sale has already been refunded")
+		return
+	}
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if sale.ProductID != nil {
+		_, err := tx.ExecContext(ctx, `UPDATE products SET stock = stock + $1 WHERE id = $2`, sale.Quantity, *sale.ProductID)
+		if err != nil {
+			writeInternalError(w, err)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, sale)
+}
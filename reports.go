@@ -0,0 +1,675 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+)
+
+type salesSummary struct {
+	Currency         string `json:"currency"`
+	TotalSales       int    `json:"totalSales"`
+	TotalQuantity    int    `json:"totalQuantity"`
+	TotalRevenue     money  `json:"totalRevenue"`
+	TotalNetAmount   money  `json:"totalNetAmount"`
+	AverageSaleValue money  `json:"averageSaleValue"`
+	MinSaleValue     money  `json:"minSaleValue"`
+	MaxSaleValue     money  `json:"maxSaleValue"`
+}
+
+func getSalesSummary(w http.ResponseWriter, r *http.Request) {
+
+	f := revenueSales()
+	if err := f.addCurrency(r.URL.Query()); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := f.addDateRange(r.URL.Query()); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s := salesSummary{Currency: normalizeCurrency(r.URL.Query().Get("currency"))}
+	err := db.QueryRowContext(r.Context(), `
+		SELECT COUNT(*),
+		       COALESCE(SUM(quantity), 0),
+		       COALESCE(SUM(price * quantity), 0),
+		       COALESCE(SUM(COALESCE(net_amount, price * quantity)), 0),
+		       COALESCE(AVG(price * quantity), 0),
+		       COALESCE(MIN(price * quantity), 0),
+		       COALESCE(MAX(price * quantity), 0)
+		FROM sales
+		`+f.where(), f.args...).Scan(
+		&s.TotalSales,
+		&s.TotalQuantity,
+		&s.TotalRevenue,
+		&s.TotalNetAmount,
+		&s.AverageSaleValue,
+		&s.MinSaleValue,
+		&s.MaxSaleValue,
+	)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s)
+}
+
+// getSalesCount returns just the number of matching sales, for clients that
+// do not need the rows.
+func getSalesCount(w http.ResponseWriter, r *http.Request) {
+
+	f := activeSales()
+	if err := f.addDateRange(r.URL.Query()); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var count int
+	err := db.QueryRowContext(r.Context(), `SELECT COUNT(*) FROM sales `+f.where(), f.args...).Scan(&count)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]int{"count": count})
+}
+
+type salesProfit struct {
+	Currency      string  `json:"currency"`
+	TotalRevenue  money   `json:"totalRevenue"`
+	TotalCost     money   `json:"totalCost"`
+	Profit        money   `json:"profit"`
+	MarginPercent float64 `json:"marginPercent"`
+}
+
+// getSalesProfit reports revenue, cost and profit for the period. Revenue
+// is after discount and before tax, which the shop only collects; cost uses
+// the cost price snapshotted on each sale, so sales made before a product
+// had a cost price count as costing nothing.
+func getSalesProfit(w http.ResponseWriter, r *http.Request) {
+
+	f := revenueSales()
+	if err := f.addCurrency(r.URL.Query()); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := f.addDateRange(r.URL.Query()); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	p := salesProfit{Currency: normalizeCurrency(r.URL.Query().Get("currency"))}
+	err := db.QueryRowContext(r.Context(), `
+		SELECT COALESCE(SUM(price * quantity - discount), 0),
+		       COALESCE(SUM(cost_price * quantity), 0)
+		FROM sales
+		`+f.where(), f.args...).Scan(&p.TotalRevenue, &p.TotalCost)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	p.Profit = p.TotalRevenue - p.TotalCost
+	if p.TotalRevenue != 0 {
+		p.MarginPercent = math.Round(float64(p.Profit/p.TotalRevenue)*10000) / 100
+	}
+
+	writeJSON(w, http.StatusOK, p)
+}
+
+type productSales struct {
+	ProductName   string `json:"productName"`
+	TotalQuantity int    `json:"totalQuantity"`
+	TotalRevenue  money  `json:"totalRevenue"`
+}
+
+func getSalesByProduct(w http.ResponseWriter, r *http.Request) {
+
+	f := revenueSales()
+	if err := f.addCurrency(r.URL.Query()); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := f.addDateRange(r.URL.Query()); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rows, err := db.QueryContext(r.Context(), `
+		SELECT COALESCE(product_name, ''),
+		       COALESCE(SUM(quantity), 0),
+		       COALESCE(SUM(price * quantity), 0)
+		FROM sales
+		`+f.where()+`
+		GROUP BY product_name
+		ORDER BY SUM(quantity) DESC
+	`, f.args...)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer rows.Close()
+
+	products := []productSales{}
+
+	for rows.Next() {
+		var p productSales
+		if err := rows.Scan(&p.ProductName, &p.TotalQuantity, &p.TotalRevenue); err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		products = append(products, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, products)
+}
+
+type productAverages struct {
+	ProductName     string  `json:"productName"`
+	SaleCount       int     `json:"saleCount"`
+	AveragePrice    money   `json:"averagePrice"`
+	MinPrice        money   `json:"minPrice"`
+	MaxPrice        money   `json:"maxPrice"`
+	AverageQuantity float64 `json:"averageQuantity"`
+}
+
+// getSalesAvgByProduct reports the typical unit price and quantity of each
+// product. A wide gap between a product's minimum and maximum price usually
+// means a sale was entered wrongly.
+func getSalesAvgByProduct(w http.ResponseWriter, r *http.Request) {
+
+	f := revenueSales()
+	if err := f.addCurrency(r.URL.Query()); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := f.addDateRange(r.URL.Query()); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rows, err := db.QueryContext(r.Context(), `
+		SELECT COALESCE(product_name, ''),
+		       COUNT(*),
+		       AVG(price),
+		       MIN(price),
+		       MAX(price),
+		       ROUND(AVG(quantity), 2)
+		FROM sales
+		`+f.where()+`
+		GROUP BY product_name
+		ORDER BY product_name
+	`, f.args...)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer rows.Close()
+
+	products := []productAverages{}
+
+	for rows.Next() {
+		var p productAverages
+		if err := rows.Scan(&p.ProductName, &p.SaleCount, &p.AveragePrice, &p.MinPrice, &p.MaxPrice, &p.AverageQuantity); err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		products = append(products, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, products)
+}
+
+// dailyDefaultDays is how far back /sales/daily looks when no range is given.
+const dailyDefaultDays = 30
+
+type dailySales struct {
+	Date    string `json:"date"`
+	Count   int    `json:"count"`
+	Revenue money  `json:"revenue"`
+}
+
+func getDailySales(w http.ResponseWriter, r *http.Request) {
+
+	q := r.URL.Query()
+
+	f := revenueSales()
+	if err := f.addCurrency(r.URL.Query()); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := f.addDateRange(q); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if q.Get("from") == "" && q.Get("to") == "" {
+		now := time.Now().In(shopLocation)
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, shopLocation)
+		f.add("created_date >= $%d", today.AddDate(0, 0, -(dailyDefaultDays-1)).UTC())
+	}
+
+	rows, err := db.QueryContext(r.Context(), `
+		SELECT TO_CHAR(DATE_TRUNC('day', `+createdDateLocal+`), 'YYYY-MM-DD') AS day,
+		       COUNT(*),
+		       COALESCE(SUM(price * quantity), 0)
+		FROM sales
+		`+f.where()+`
+		GROUP BY day
+		ORDER BY day
+	`, f.args...)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer rows.Close()
+
+	days := []dailySales{}
+
+	for rows.Next() {
+		var d dailySales
+		if err := rows.Scan(&d.Date, &d.Count, &d.Revenue); err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		days = append(days, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, days)
+}
+
+type paymentSales struct {
+	PaymentMethod string `json:"paymentMethod"`
+	Count         int    `json:"count"`
+	TotalQuantity int    `json:"totalQuantity"`
+	TotalRevenue  money  `json:"totalRevenue"`
+}
+
+func getSalesByPayment(w http.ResponseWriter, r *http.Request) {
+
+	f := revenueSales()
+	if err := f.addCurrency(r.URL.Query()); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := f.addDateRange(r.URL.Query()); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Missing methods are bucketed as UNKNOWN so the per-method totals
+	// still add up to the overall summary.
+	rows, err := db.QueryContext(r.Context(), `
+		SELECT COALESCE(NULLIF(UPPER(TRIM(payment_method)), ''), 'UNKNOWN') AS method,
+		       COUNT(*),
+		       COALESCE(SUM(quantity), 0),
+		       COALESCE(SUM(price * quantity), 0)
+		FROM sales
+		`+f.where()+`
+		GROUP BY method
+		ORDER BY method
+	`, f.args...)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer rows.Close()
+
+	methods := []paymentSales{}
+
+	for rows.Next() {
+		var p paymentSales
+		if err := rows.Scan(&p.PaymentMethod, &p.Count, &p.TotalQuantity, &p.TotalRevenue); err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		methods = append(methods, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, methods)
+}
+
+type monthlySales struct {
+	Month   string `json:"month"`
+	Count   int    `json:"count"`
+	Revenue money  `json:"revenue"`
+}
+
+func getMonthlySales(w http.ResponseWriter, r *http.Request) {
+
+	year, err := parseIntParam(r.URL.Query(), "year", 0, 1970, 9999)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	f := revenueSales()
+	if err := f.addCurrency(r.URL.Query()); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if year != 0 {
+		start := time.Date(year, time.January, 1, 0, 0, 0, 0, shopLocation)
+		f.add("created_date >= $%d", start.UTC())
+		f.add("created_date < $%d", start.AddDate(1, 0, 0).UTC())
+	}
+
+	rows, err := db.QueryContext(r.Context(), `
+		SELECT TO_CHAR(DATE_TRUNC('month', `+createdDateLocal+`), 'YYYY-MM') AS month,
+		       COUNT(*),
+		       COALESCE(SUM(price * quantity), 0)
+		FROM sales
+		`+f.where()+`
+		GROUP BY month
+		ORDER BY month
+	`, f.args...)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer rows.Close()
+
+	months := []monthlySales{}
+
+	for rows.Next() {
+		var m monthlySales
+		if err := rows.Scan(&m.Month, &m.Count, &m.Revenue); err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		months = append(months, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, months)
+}
+
+const (
+	defaultTopCustomers = 10
+	maxTopCustomers     = 100
+)
+
+type customerSales struct {
+	CustomerName string `json:"customerName"`
+	Count        int    `json:"count"`
+	Revenue      money  `json:"revenue"`
+}
+
+func getTopCustomers(w http.ResponseWriter, r *http.Request) {
+
+	q := r.URL.Query()
+
+	limit, err := parseIntParam(q, "limit", defaultTopCustomers, 1, maxTopCustomers)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	f := revenueSales()
+	if err := f.addCurrency(r.URL.Query()); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := f.addDateRange(q); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Anonymous sales share one WALK-IN bucket rather than disappearing.
+	where := f.where()
+	limitArg := f.arg(limit)
+
+	rows, err := db.QueryContext(r.Context(), `
+		SELECT COALESCE(NULLIF(TRIM(customer_name), ''), 'WALK-IN') AS customer,
+		       COUNT(*),
+		       COALESCE(SUM(price * quantity), 0) AS revenue
+		FROM sales
+		`+where+`
+		GROUP BY customer
+		ORDER BY revenue DESC, customer
+		LIMIT `+limitArg, f.args...)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer rows.Close()
+
+	customers := []customerSales{}
+
+	for rows.Next() {
+		var c customerSales
+		if err := rows.Scan(&c.CustomerName, &c.Count, &c.Revenue); err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		customers = append(customers, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, customers)
+}
+
+type hourlySales struct {
+	Hour    int   `json:"hour"`
+	Count   int   `json:"count"`
+	Revenue money `json:"revenue"`
+}
+
+// getSalesByHour buckets sales by local hour of day. All 24 hours are
+// returned, with zeros for hours that had no sales.
+func getSalesByHour(w http.ResponseWriter, r *http.Request) {
+
+	f := revenueSales()
+	if err := f.addCurrency(r.URL.Query()); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := f.addDateRange(r.URL.Query()); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rows, err := db.QueryContext(r.Context(), `
+		SELECT EXTRACT(HOUR FROM `+createdDateLocal+`)::int AS hour,
+		       COUNT(*),
+		       COALESCE(SUM(price * quantity), 0)
+		FROM sales
+		`+f.where()+`
+		GROUP BY hour
+	`, f.args...)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer rows.Close()
+
+	hours := make([]hourlySales, 24)
+	for h := range hours {
+		hours[h].Hour = h
+	}
+
+	for rows.Next() {
+		var h hourlySales
+		if err := rows.Scan(&h.Hour, &h.Count, &h.Revenue); err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		if h.Hour >= 0 && h.Hour < len(hours) {
+			hours[h.Hour] = h
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, hours)
+}
+
+// maxFilledWeeks bounds how many weeks fill=true may generate, so an open
+// date range cannot produce an enormous response.
+const maxFilledWeeks = 520
+
+type weeklySales struct {
+	Week      string `json:"week"`
+	WeekStart string `json:"weekStart"`
+	Count     int    `json:"count"`
+	Revenue   money  `json:"revenue"`
+}
+
+// getWeeklySales buckets sales by local ISO week, oldest first. Weeks are
+// labelled like "2024-W05" and start on Monday. With fill=true, weeks with
+// no sales between the bounds (or the first and last sale) are included
+// with zeros.
+func getWeeklySales(w http.ResponseWriter, r *http.Request) {
+
+	q := r.URL.Query()
+
+	f := revenueSales()
+	if err := f.addCurrency(q); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := f.addDateRange(q); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	fill := q.Get("fill") == "true"
+
+	// addDateRange has already rejected malformed bounds.
+	var from, to time.Time
+	if raw := q.Get("from"); raw != "" {
+		from, _, _ = parseDateParam(raw)
+	}
+	if raw := q.Get("to"); raw != "" {
+		to, _, _ = parseDateParam(raw)
+	}
+
+	rows, err := db.QueryContext(r.Context(), `
+		SELECT TO_CHAR(DATE_TRUNC('week', `+createdDateLocal+`), 'YYYY-MM-DD') AS week_start,
+		       COUNT(*),
+		       COALESCE(SUM(price * quantity), 0)
+		FROM sales
+		`+f.where()+`
+		GROUP BY week_start
+		ORDER BY week_start
+	`, f.args...)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer rows.Close()
+
+	weeks := []weeklySales{}
+
+	for rows.Next() {
+		var wk weeklySales
+		if err := rows.Scan(&wk.WeekStart, &wk.Count, &wk.Revenue); err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		start, err := time.ParseInLocation("2006-01-02", wk.WeekStart, shopLocation)
+		if err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		wk.Week = isoWeekLabel(start)
+		weeks = append(weeks, wk)
+	}
+
+	if err := rows.Err(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	if fill {
+		var ok bool
+		if weeks, ok = fillWeeks(weeks, from, to); !ok {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("fill covers at most %d weeks; narrow from and to", maxFilledWeeks))
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, weeks)
+}
+
+// isoWeekStart returns local midnight on the Monday of t's ISO week.
+func isoWeekStart(t time.Time) time.Time {
+	t = t.In(shopLocation)
+	daysSinceMonday := (int(t.Weekday()) + 6) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-daysSinceMonday, 0, 0, 0, 0, shopLocation)
+}
+
+func isoWeekLabel(weekStart time.Time) string {
+	year, week := weekStart.ISOWeek()
+	return fmt.Sprintf("%d-W%02d", year, week)
+}
+
+// fillWeeks returns weeks with a zero entry for every missing week from
+// the week of from (or the first entry) to the week of to (or the last
+// entry). weeks must be ordered oldest first. It reports false when that
+// span is longer than maxFilledWeeks.
+func fillWeeks(weeks []weeklySales, from, to time.Time) ([]weeklySales, bool) {
+
+	byStart := map[string]weeklySales{}
+	for _, wk := range weeks {
+		byStart[wk.WeekStart] = wk
+	}
+
+	if from.IsZero() && len(weeks) > 0 {
+		from, _ = time.ParseInLocation("2006-01-02", weeks[0].WeekStart, shopLocation)
+	}
+	if to.IsZero() && len(weeks) > 0 {
+		to, _ = time.ParseInLocation("2006-01-02", weeks[len(weeks)-1].WeekStart, shopLocation)
+	}
+	if from.IsZero() || to.IsZero() {
+		return weeks, true
+	}
+
+	filled := []weeklySales{}
+	for start := isoWeekStart(from); !start.After(to); start = start.AddDate(0, 0, 7) {
+		if len(filled) == maxFilledWeeks {
+			return nil, false
+		}
+		key := start.Format("2006-01-02")
+		wk, ok := byStart[key]
+		if !ok {
+			wk = weeklySales{Week: isoWeekLabel(start), WeekStart: key}
+		}
+		filled = append(filled, wk)
+	}
+	return filled, true
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxBodyBytes caps the size of JSON request bodies. It is set from
+// MAX_BODY_BYTES at startup.
+var maxBodyBytes int64 = 1 << 20
+
+// envelope wraps every JSON response so clients can parse success and
+// failure the same way: exactly one of Data and Error is set.
+type envelope struct {
+	Data  interface{}    `json:"data"`
+	Error *errorResponse `json:"error"`
+}
+
+// errorResponse describes a failed request inside the envelope.
+type errorResponse struct {
+	Code    int               `json:"code"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+
+	// RequestID lets a client quote the failing request to support.
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// writeJSON sends data wrapped in the success envelope.
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	writeEnvelope(w, status, envelope{Data: data})
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeErrorResponse(w, errorResponse{Code: status, Message: msg})
+}
+
+// writeFieldErrors reports a validation failure with a message per field.
+func writeFieldErrors(w http.ResponseWriter, fields map[string]string) {
+	writeErrorResponse(w, errorResponse{
+		Code:    http.StatusBadRequest,
+		Message: "validation failed",
+		Fields:  fields,
+	})
+}
+
+// writeInternalError logs err and responds with a generic 500 so database
+// details are never exposed to clients.
+func writeInternalError(w http.ResponseWriter, err error) {
+	slog.Error("internal error", "err", err, "requestId", w.Header().Get(requestIDHeader))
+	writeError(w, http.StatusInternalServerError, "internal server error")
+}
+
+// writeErrorResponse sends resp in the envelope, tagged with the request ID
+// that withRequestID put in the response headers.
+func writeErrorResponse(w http.ResponseWriter, resp errorResponse) {
+	resp.RequestID = w.Header().Get(requestIDHeader)
+	writeEnvelope(w, resp.Code, envelope{Error: &resp})
+}
+
+func writeEnvelope(w http.ResponseWriter, status int, env envelope) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	enc := json.NewEncoder(w)
+	if wantsPrettyJSON(w) {
+		enc.SetIndent("", "  ")
+	}
+	if err := enc.Encode(env); err != nil {
+		slog.Error("encode response", "err", err, "requestId", w.Header().Get(requestIDHeader))
+	}
+}
+
+// prettyJSONWriter marks a response whose client asked for ?pretty=true.
+// It changes nothing itself; writeEnvelope looks for it to indent.
+type prettyJSONWriter struct {
+	http.ResponseWriter
+}
+
+func (p prettyJSONWriter) Unwrap() http.ResponseWriter {
+	return p.ResponseWriter
+}
+
+// withPrettyJSON indents JSON responses for requests with ?pretty=true,
+// which is easier to read from curl. Responses stay compact otherwise.
+func withPrettyJSON(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if r.URL.Query().Get("pretty") == "true" {
+			w = prettyJSONWriter{w}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// wantsPrettyJSON reports whether w, or a writer it wraps, is a
+// prettyJSONWriter.
+func wantsPrettyJSON(w http.ResponseWriter) bool {
+	for {
+		if _, ok := w.(prettyJSONWriter); ok {
+			return true
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			return false
+		}
+		w = u.Unwrap()
+	}
+}
+
+// requireJSONContentType responds 415 unless the request declares an
+// application/json body. Parameters such as charset are allowed.
+func requireJSONContentType(w http.ResponseWriter, r *http.Request) bool {
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		writeError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+		return false
+	}
+
+	return true
+}
+
+// decodeJSON decodes the request body into v, rejecting bodies larger than
+// maxBodyBytes and fields v does not declare. On failure it writes the
+// error response and returns false.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(v)
+	if err == nil {
+		return true
+	}
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit))
+		return false
+	}
+
+	if field, ok := unknownField(err); ok {
+		msg := "unknown field"
+		if known := matchJSONField(v, field); known != "" {
+			msg = fmt.Sprintf("unknown field; did you mean %q?", known)
+		}
+		writeErrorResponse(w, errorResponse{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("unknown field %q in request body", field),
+			Fields:  map[string]string{field: msg},
+		})
+		return false
+	}
+
+	// A value of the wrong type, such as a quantity sent as a string, is
+	// reported against the field like any other validation failure.
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		field := jsonFieldPath(typeErr.Field)
+		writeErrorResponse(w, errorResponse{
+			Code:    http.StatusBadRequest,
+			Message: fmt.Sprintf("invalid type for field %q in request body", field),
+			Fields:  map[string]string{field: "must be " + jsonTypeName(typeErr.Type)},
+		})
+		return false
+	}
+
+	writeError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+	return false
+}
+
+// jsonFieldPath rewrites the decoder's dotted path, e.g. "items.1.quantity",
+// into the "items[1].quantity" form the field error maps use. A leading
+// index, from a body that is itself an array of sales, is named the same
+// way as a receipt's items; see itemField.
+func jsonFieldPath(path string) string {
+
+	parts := strings.Split(path, ".")
+
+	var b strings.Builder
+	for i, part := range parts {
+		if _, err := strconv.Atoi(part); err == nil {
+			if i == 0 {
+				b.WriteString("items")
+			}
+			b.WriteString("[" + part + "]")
+			continue
+		}
+		if i > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(part)
+	}
+	return b.String()
+}
+
+// jsonTypeName describes the JSON value a Go type decodes from.
+func jsonTypeName(t reflect.Type) string {
+
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		if t == reflect.TypeOf(time.Time{}) {
+			return "an RFC 3339 timestamp"
+		}
+		return "an object"
+	}
+	return "a string"
+}
+
+// unknownField extracts the field name from the error the decoder returns
+// under DisallowUnknownFields, which has no dedicated error type.
+func unknownField(err error) (string, bool) {
+
+	const prefix = "json: unknown field "
+
+	msg := err.Error()
+	if !strings.HasPrefix(msg, prefix) {
+		return "", false
+	}
+
+	field, uerr := strconv.Unquote(strings.TrimPrefix(msg, prefix))
+	if uerr != nil {
+		return "", false
+	}
+	return field, true
+}
+
+// matchJSONField returns the JSON name of the field in v's struct type (or
+// its element type, for slices) that name most likely meant, ignoring case
+// and underscores or dashes, e.g. "customer_name" for "customerName".
+// encoding/json already matches names case-insensitively, so separators are
+// what usually trip clients up.
+func matchJSONField(v interface{}, name string) string {
+
+	normalize := strings.NewReplacer("_", "", "-", "").Replace
+
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return ""
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+
+		// Embedded structs contribute their fields at the same level.
+		if field.Anonymous && tag == "" {
+			if known := matchJSONField(reflect.New(field.Type).Interface(), name); known != "" {
+				return known
+			}
+			continue
+		}
+
+		if tag != "" && tag != "-" && strings.EqualFold(tag, normalize(name)) {
+			return tag
+		}
+	}
+	return ""
+}
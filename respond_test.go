@@ -0,0 +1,20 @@
+package main
+
+import "testing"
+
+func TestJSONFieldPath(t *testing.T) {
+
+	tests := map[string]string{
+		"quantity":         "quantity",
+		"items.1.quantity": "items[1].quantity",
+		"items.0.a.2.b":    "items[0].a[2].b",
+		"0.price":          "items[0].price",
+		"":                 "",
+	}
+
+	for in, want := range tests {
+		if got := jsonFieldPath(in); got != want {
+			t.Errorf("jsonFieldPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// minSearchLength keeps /sales/search from matching the whole table on a
+// near-empty term.
+const minSearchLength = 2
+
+// searchResult is the /sales/search response. Truncated is set when more
+// sales match than Limit.
+type searchResult struct {
+	Sales     []Sale `json:"sales"`
+	Limit     int    `json:"limit"`
+	MaxLimit  int    `json:"maxLimit"`
+	Truncated bool   `json:"truncated"`
+}
+
+// searchSales matches q against both customer and product names, returning
+// at most limit sales, which like GET /sales is capped by maxSalesLimit.
+func searchSales(w http.ResponseWriter, r *http.Request) {
+
+	q := r.URL.Query()
+
+	term := strings.TrimSpace(q.Get("q"))
+	if utf8.RuneCountInString(term) < minSearchLength {
+		writeError(w, http.StatusBadRequest, "q must be at least 2 characters")
+		return
+	}
+
+	limit, err := parseIntParam(q, "limit", maxSalesLimit, 1, maxSalesLimit)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	f := activeSales()
+	f.add("(customer_name ILIKE $%[1]d OR product_name ILIKE $%[1]d)", "%"+escapeLike(term)+"%")
+
+	// One row past the limit shows whether the result was cut short.
+	where := f.where()
+	limitArg := f.arg(limit + 1)
+
+	sales, err := querySales(r.Context(), `
+		SELECT `+saleColumns+`
+		FROM sales
+		`+where+`
+		ORDER BY created_date DESC, sale_id DESC
+		LIMIT `+limitArg, f.args...)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	res := searchResult{Sales: sales, Limit: limit, MaxLimit: maxSalesLimit}
+	if len(sales) > limit {
+		res.Sales = sales[:limit]
+		res.Truncated = true
+	}
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+// maxSuggestions caps the autocomplete lists.
+const maxSuggestions = 50
+
+// getSaleProductNames lists the distinct product names used on sales, for
+// type-ahead on the entry form.
+func getSaleProductNames(w http.ResponseWriter, r *http.Request) {
+	distinctSaleValues(w, r, "product_name")
+}
+
+// getSaleCustomerNames lists the distinct customer names used on sales.
+func getSaleCustomerNames(w http.ResponseWriter, r *http.Request) {
+	distinctSaleValues(w, r, "customer_name")
+}
+
+// distinctSaleValues responds with the sorted distinct non-empty values of
+// column, optionally narrowed to those starting with the prefix parameter.
+// column is always a constant supplied by the caller, never user input.
+func distinctSaleValues(w http.ResponseWriter, r *http.Request, column string) {
+
+	f := activeSales()
+	f.cond(column + " <> ''")
+
+	if prefix := strings.TrimSpace(r.URL.Query().Get("prefix")); prefix != "" {
+		f.add(column+" ILIKE $%d", escapeLike(prefix)+"%")
+	}
+
+	where := f.where()
+	limitArg := f.arg(maxSuggestions)
+
+	rows, err := db.QueryContext(r.Context(), `
+		SELECT DISTINCT `+column+`
+		FROM sales
+		`+where+`
+		ORDER BY `+column+`
+		LIMIT `+limitArg, f.args...)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer rows.Close()
+
+	values := []string{}
+
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			writeInternalError(w, err)
+			return
+		}
+		values = append(values, v)
+	}
+
+	if err := rows.Err(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, values)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Limits for /admin/seed.
+const (
+	defaultSeedCount = 50
+	maxSeedCount     = 1000
+	defaultSeedDays  = 30
+	maxSeedDays      = 365
+)
+
+// seedLockID is the advisory lock key that stops concurrent seed calls
+// from both topping the table up.
+const seedLockID = 7263542
+
+var demoShops = []string{"Gandhipark", "KurnoolRoad"}
+
+var demoStaff = []string{"Imran", "Sandeep", "Meena"}
+
+var demoCustomers = []string{
+	"Ravi Kumar", "Lakshmi Devi", "Mohammed Irfan", "Sravani Reddy",
+	"Venkatesh Rao", "Ayesha Begum", "Suresh Babu", "Priya Sharma",
+	"Naveen Goud", "Fathima Shaik", "Kiran Naidu", "Anjali Gupta",
+}
+
+// demoProducts mirror the catalogue shown on the sales page.
+var demoProducts = []struct {
+	name     string
+	price    money
+	cells    []string
+	warranty []string
+}{
+	{name: "Gents Belt Watch", price: 1499, warranty: []string{"6 Months", "1 Year"}},
+	{name: "Gents Chain Watch", price: 2499, warranty: []string{"6 Months", "1 Year"}},
+	{name: "Ladies Belt Watch", price: 1299, warranty: []string{"6 Months", "1 Year"}},
+	{name: "Ladies Chain Watch", price: 2199, warranty: []string{"6 Months", "1 Year"}},
+	{name: "Wall Clock", price: 799, warranty: []string{"3 Months", "6 Months"}},
+	{name: "Alarm Timepiece", price: 349, warranty: []string{"3 Months"}},
+	{name: "Titan Cell", price: 150, cells: []string{"521", "626", "621", "721", "920"}},
+	{name: "Watch Cell", price: 60, cells: []string{"G1", "521", "626", "621", "721", "920", "2016", "2025", "2032"}},
+	{name: "Strap", price: 199},
+	{name: "Chain", price: 299},
+	{name: "Repair", price: 250},
+}
+
+type seedResult struct {
+	Inserted  int `json:"inserted"`
+	DemoSales int `json:"demoSales"`
+}
+
+// seedSales tops the table up to count demo sales (default 50) spread over
+// the last days days (default 30), so a fresh deployment has something to
+// show. Seeded rows have demo set and can be removed with DELETE
+// /admin/seed. Repeating the call inserts only what is missing.
+func seedSales(w http.ResponseWriter, r *http.Request) {
+
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	q := r.URL.Query()
+
+	count, err := parseIntParam(q, "count", defaultSeedCount, 1, maxSeedCount)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	days, err := parseIntParam(q, "days", defaultSeedDays, 1, maxSeedDays)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx := r.Context()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, seedLockID); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	var existing int
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM sales WHERE demo AND deleted_at IS NULL`).Scan(&existing)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	sales := demoSales(count-existing, days)
+
+	for i := range sales {
+		if err := insertSale(ctx, tx, &sales[i]); err != nil {
+			writeInternalError(w, err)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, seedResult{Inserted: len(sales), DemoSales: existing + len(sales)})
+}
+
+// demoSales generates n random demo sales dated within the last days
+// days, oldest first.
+func demoSales(n, days int) []Sale {
+
+	if n <= 0 {
+		return nil
+	}
+
+	now := time.Now()
+	span := time.Duration(days) * 24 * time.Hour
+
+	sales := make([]Sale, n)
+	for i := range sales {
+		p := demoProducts[rand.IntN(len(demoProducts))]
+
+		s := Sale{
+			ShopName:      demoShops[rand.IntN(len(demoShops))],
+			CustomerName:  demoCustomers[rand.IntN(len(demoCustomers))],
+			ProductName:   p.name,
+			Quantity:      1 + rand.IntN(3),
+			Price:         p.price,
+			PaymentMethod: []string{"CASH", "CARD", "UPI"}[rand.IntN(3)],
+			Currency:      defaultCurrency,
+			CreatedDate:   now.Add(-time.Duration(rand.Int64N(int64(span)))),
+			Demo:          true,
+			CreatedBy:     demoStaff[rand.IntN(len(demoStaff))],
+		}
+		if len(p.cells) > 0 {
+			s.CellName = p.cells[rand.IntN(len(p.cells))]
+		}
+		if len(p.warranty) > 0 {
+			s.Warranty = p.warranty[rand.IntN(len(p.warranty))]
+		}
+		if rand.IntN(5) == 0 {
+			s.Discount = money(rand.IntN(3)+1) * 50
+			s.Discount = min(s.Discount, s.Price*money(s.Quantity))
+		}
+		sales[i] = s
+	}
+
+	sort.Slice(sales, func(i, j int) bool {
+		return sales[i].CreatedDate.Before(sales[j].CreatedDate)
+	})
+	return sales
+}
+
+// deleteDemoSales removes every demo sale, leaving real sales untouched.
+func deleteDemoSales(w http.ResponseWriter, r *http.Request) {
+
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	res, err := db.ExecContext(r.Context(), `DELETE FROM sales WHERE demo`)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]int64{"rowsDeleted": n})
+}
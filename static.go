@@ -0,0 +1,41 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+)
+
+// staticPattern is the catch-all pattern staticHandler is registered under.
+const staticPattern = "GET /"
+
+// staticHandler serves the frontend from dir. With no directory, or one
+// that does not exist, it answers / with the API index and every other
+// unmatched path with a JSON 404 so the catch-all cannot hide a missing
+// API route behind an HTML page.
+func staticHandler(dir string) http.Handler {
+
+	if dir == "" {
+		slog.Info("static file server disabled")
+		return http.HandlerFunc(apiOnly)
+	}
+
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		slog.Warn("static directory not found; file server disabled", "dir", dir)
+		return http.HandlerFunc(apiOnly)
+	}
+
+	return http.FileServer(http.Dir(dir))
+}
+
+func apiOnly(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/" {
+		getAPIIndex(w, r)
+		return
+	}
+	notFound(w, r)
+}
+
+func notFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusNotFound, "not found")
+}
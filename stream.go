@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+// streamFlushRows is how many sales /sales/stream writes between flushes.
+const streamFlushRows = 100
+
+// streamSales writes every matching sale as newline-delimited JSON, oldest
+// first, flushing as it goes so neither side holds the full set. Unlike
+// /sales there is no page cap. A client that disconnects cancels the
+// request context, which ends the query.
+func streamSales(w http.ResponseWriter, r *http.Request) {
+
+	f := activeSales()
+	if err := f.addDateRange(r.URL.Query()); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx := r.Context()
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+saleColumns+`
+		FROM sales
+		`+f.where()+`
+		ORDER BY created_date, sale_id
+	`, f.args...)
+	if err != nil {
+		writeInternalError(w, err)
+		return
+	}
+	defer rows.Close()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+
+	rc := http.NewResponseController(w)
+	enc := json.NewEncoder(w)
+
+	for n := 1; rows.Next(); n++ {
+		s, err := scanSale(rows)
+		if err != nil {
+			slog.ErrorContext(ctx, "stream sales", "err", err)
+			return
+		}
+
+		if err := enc.Encode(s); err != nil {
+			return // the client has gone away
+		}
+
+		if n%streamFlushRows == 0 {
+			rc.Flush()
+		}
+	}
+
+	if err := rows.Err(); err != nil && ctx.Err() == nil {
+		slog.ErrorContext(ctx, "stream sales", "err", err)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxNetAmount is the largest total the sales.net_amount column holds.
+const maxNetAmount = 9999999999.99
+
+// createdDateSkew is how far into the future a client-supplied createdDate
+// may be, to tolerate small clock differences.
+const createdDateSkew = time.Minute
+
+// paymentMethods is the set of payment methods a sale may be recorded with.
+var paymentMethods = map[string]bool{
+	"CASH": true,
+	"CARD": true,
+	"UPI":  true,
+}
+
+// defaultPaymentMethod is recorded when a sale names no payment method. It
+// is set from DEFAULT_PAYMENT_METHOD at startup.
+var defaultPaymentMethod = "CASH"
+
+// normalizePaymentMethod maps a client-supplied payment method to its
+// canonical form so "cash", "Cash " and "CASH" are stored alike. Whether
+// the result is a known method is left to validateSale.
+func normalizePaymentMethod(method string) string {
+	method = strings.ToUpper(strings.TrimSpace(method))
+	if method == "" {
+		return defaultPaymentMethod
+	}
+	return method
+}
+
+// currencies is the set of ISO 4217 codes a sale may be recorded in.
+var currencies = map[string]bool{
+	"INR": true,
+	"USD": true,
+	"EUR": true,
+	"GBP": true,
+	"AED": true,
+}
+
+// defaultCurrency is recorded when a sale names no currency, and is the
+// currency reports cover unless asked for another.
+const defaultCurrency = "INR"
+
+// normalizeCurrency upper-cases a currency code, defaulting to INR.
+func normalizeCurrency(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return defaultCurrency
+	}
+	return code
+}
+
+// validateSale checks the fields a client must supply for a sale and returns
+// a message per failing field, keyed by its JSON name. A nil map means the
+// sale is valid. The payment method and currency must already be normalized.
+//
+// Single-field constraints come from the validate tags on Sale; the checks
+// below cover what a tag cannot express.
+func validateSale(s Sale) map[string]string {
+
+	errs := checkConstraints(s)
+
+	if _, bad := errs["discount"]; !bad && s.Price >= 0 && s.Discount > s.Price*money(s.Quantity) {
+		errs["discount"] = "must not exceed price times quantity"
+	}
+
+	// net_amount is NUMERIC(12,2); a larger total would fail the insert.
+	if len(errs) == 0 && float64(s.Price*money(s.Quantity)-s.Discount)*(1+s.TaxRate) > maxNetAmount {
+		errs["quantity"] = "price times quantity, after discount and tax, must be at most " + formatBound(maxNetAmount)
+	}
+
+	if !paymentMethods[s.PaymentMethod] {
+		errs["paymentMethod"] = "must be one of CASH, CARD, UPI"
+	}
+
+	if !currencies[s.Currency] {
+		errs["currency"] = "must be one of " + currencyList()
+	}
+
+	if s.CreatedDate.After(time.Now().Add(createdDateSkew)) {
+		errs["createdDate"] = "must not be in the future"
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// currencyList returns the supported currencies for error messages.
+func currencyList() string {
+	list := make([]string, 0, len(currencies))
+	for c := range currencies {
+		list = append(list, c)
+	}
+	sort.Strings(list)
+	return strings.Join(list, ", ")
+}
+
+// checkConstraints applies the validate struct tags of v, a struct, and
+// returns a message per failing field keyed by its JSON name. The map is
+// never nil. Supported rules, comma-separated:
+//
+//	required  string must not be blank
+//	gt=N      number must be greater than N
+//	gte=N     number must be at least N
+//	lte=N     number must be at most N
+//
+// gte and lte together read as a range. A malformed tag is a programming
+// error and panics.
+func checkConstraints(v interface{}) map[string]string {
+
+	errs := map[string]string{}
+
+	rv := reflect.ValueOf(v)
+	rt := rv.Type()
+
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		tag := field.Tag.Get("validate")
+		if tag == "" {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if msg := checkField(rv.Field(i), tag); msg != "" {
+			errs[name] = msg
+		}
+	}
+	return errs
+}
+
+// checkField returns the message for the first rule in tag that value
+// breaks, or "" when it satisfies them all.
+func checkField(value reflect.Value, tag string) string {
+
+	var num float64
+	switch value.Kind() {
+	case reflect.Int, reflect.Int64:
+		num = float64(value.Int())
+	case reflect.Float64:
+		num = value.Float()
+	}
+
+	bounds := map[string]float64{}
+	for _, rule := range strings.Split(tag, ",") {
+		key, arg, _ := strings.Cut(rule, "=")
+		switch key {
+		case "required":
+			if strings.TrimSpace(value.String()) == "" {
+				return "is required"
+			}
+		case "gt", "gte", "lte":
+			n, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				panic(fmt.Sprintf("validate: bad rule %q", rule))
+			}
+			bounds[key] = n
+		default:
+			panic(fmt.Sprintf("validate: unknown rule %q", rule))
+		}
+	}
+
+	// Every comparison with NaN is false, so it would pass any bound.
+	if len(bounds) > 0 && (math.IsNaN(num) || math.IsInf(num, 0)) {
+		return "must be a finite number"
+	}
+
+	if n, ok := bounds["gt"]; ok && num <= n {
+		return fmt.Sprintf("must be greater than %s", formatBound(n))
+	}
+
+	lo, hasLo := bounds["gte"]
+	hi, hasHi := bounds["lte"]
+	switch {
+	case hasLo && hasHi && (num < lo || num > hi):
+		return fmt.Sprintf("must be between %s and %s", formatBound(lo), formatBound(hi))
+	case hasLo && num < lo:
+		return fmt.Sprintf("must be at least %s", formatBound(lo))
+	case hasHi && num > hi:
+		return fmt.Sprintf("must be at most %s", formatBound(hi))
+	}
+	return ""
+}
+
+// formatBound writes a rule's bound in plain decimal, so column limits such
+// as 99999999.99 read as written rather than in exponent form.
+func formatBound(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
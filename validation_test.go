@@ -0,0 +1,101 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestCheckField(t *testing.T) {
+
+	tests := []struct {
+		value interface{}
+		tag   string
+		want  string
+	}{
+		{"Ravi", "required", ""},
+		{"  ", "required", "is required"},
+		{0, "gt=0", "must be greater than 0"},
+		{1, "gt=0", ""},
+		{0.5, "gte=0,lte=1", ""},
+		{1.5, "gte=0,lte=1", "must be between 0 and 1"},
+		{-1.0, "gte=0", "must be at least 0"},
+		{money(100000000), "gte=0,lte=99999999.99", "must be between 0 and 99999999.99"},
+		{2147483648, "lte=2147483647", "must be at most 2147483647"},
+		{math.NaN(), "gte=0", "must be a finite number"},
+		{math.Inf(1), "lte=1", "must be a finite number"},
+		{math.NaN(), "required", ""},
+	}
+
+	for _, tt := range tests {
+		if got := checkField(reflect.ValueOf(tt.value), tt.tag); got != tt.want {
+			t.Errorf("checkField(%v, %q) = %q, want %q", tt.value, tt.tag, got, tt.want)
+		}
+	}
+}
+
+func TestCheckFieldPanicsOnBadTag(t *testing.T) {
+
+	for _, tag := range []string{"gt=x", "between=1", "lte"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("checkField with tag %q did not panic", tag)
+				}
+			}()
+			checkField(reflect.ValueOf(1), tag)
+		}()
+	}
+}
+
+func TestCheckConstraints(t *testing.T) {
+
+	type input struct {
+		Name  string  `json:"name" validate:"required"`
+		Qty   int     `json:"qty,omitempty" validate:"gt=0"`
+		Rate  float64 `json:"rate" validate:"gte=0,lte=1"`
+		Notes string  `json:"notes"`
+	}
+
+	errs := checkConstraints(input{Rate: 2})
+	want := map[string]string{
+		"name": "is required",
+		"qty":  "must be greater than 0",
+		"rate": "must be between 0 and 1",
+	}
+	if !reflect.DeepEqual(errs, want) {
+		t.Errorf("checkConstraints = %v, want %v", errs, want)
+	}
+
+	if errs := checkConstraints(input{Name: "a", Qty: 1}); errs == nil || len(errs) != 0 {
+		t.Errorf("checkConstraints of a valid value = %#v, want an empty map", errs)
+	}
+}
+
+func TestValidateSaleBounds(t *testing.T) {
+
+	base := Sale{CustomerName: "Ravi", ProductName: "Strap", Quantity: 1, Price: 199, PaymentMethod: "CASH", Currency: "INR"}
+
+	if errs := validateSale(base); errs != nil {
+		t.Fatalf("valid sale: %v", errs)
+	}
+
+	s := base
+	s.Price = 1e9
+	if _, ok := validateSale(s)["price"]; !ok {
+		t.Error("price above NUMERIC(10,2) accepted")
+	}
+
+	s = base
+	s.Quantity = 1 << 40
+	if _, ok := validateSale(s)["quantity"]; !ok {
+		t.Error("quantity above INT4 accepted")
+	}
+
+	s = base
+	s.Price = 99999999.99
+	s.Quantity = 1000
+	if _, ok := validateSale(s)["quantity"]; !ok {
+		t.Error("total above net_amount's NUMERIC(12,2) accepted")
+	}
+}